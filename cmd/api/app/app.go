@@ -12,6 +12,9 @@ type Application struct {
 	Env         string
 	Version     string
 	TrustedCors []string
+
+	quit chan struct{}
+	stop sync.Once
 }
 
 func New(logger *slog.Logger, env, version string, trustedCors []string) *Application {
@@ -20,6 +23,7 @@ func New(logger *slog.Logger, env, version string, trustedCors []string) *Applic
 		Env:         env,
 		Version:     version,
 		TrustedCors: trustedCors,
+		quit:        make(chan struct{}),
 	}
 }
 
@@ -9,7 +9,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	tokenContextKey       = contextKey("token")
+	permissionsContextKey = contextKey("permissions")
+)
 
 func (a *Application) ContextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -24,3 +28,29 @@ func (a *Application) ContextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (a *Application) ContextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+func (a *Application) ContextGetToken(r *http.Request) string {
+	token, ok := r.Context().Value(tokenContextKey).(string)
+	if !ok {
+		panic("token not found in request context")
+	}
+
+	return token
+}
+
+func (a *Application) ContextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// ContextGetPermissions returns the permissions already resolved for the request, such as
+// the ones carried by a JWT, reporting whether there were any.
+func (a *Application) ContextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"time"
+)
+
+// Schedule runs fn every interval in the background until Shutdown is called. A run in
+// progress is waited for on shutdown, as any other background task.
+func (a *Application) Schedule(name string, interval time.Duration, fn func() error) {
+	a.Background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-a.quit:
+				return
+			case <-ticker.C:
+				if err := fn(); err != nil {
+					a.Logger.Error("scheduled job failed", "job", name, "error", err.Error())
+				}
+			}
+		}
+	})
+}
+
+// Shutdown stops the scheduled jobs.
+func (a *Application) Shutdown() {
+	a.stop.Do(func() {
+		close(a.quit)
+	})
+}
+
+// Done is closed when Shutdown is called, for background tasks that run until then.
+func (a *Application) Done() <-chan struct{} {
+	return a.quit
+}
@@ -7,17 +7,77 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hvpaiva/greenlight/cmd/api/handler"
 	"github.com/hvpaiva/greenlight/cmd/api/middleware"
+	"github.com/hvpaiva/greenlight/internal/data"
 )
 
 type config struct {
-	port    int
-	env     string
-	version string
-	debug   bool
-	db      dbConfig
-	limiter middleware.Limiter
-	cors    corsConfig
+	port       int
+	env        string
+	version    string
+	debug      bool
+	db         dbConfig
+	cors       corsConfig
+	middleware middleware.Config
+	similar    data.SimilarityWeights
+	stats      statsConfig
+	mailer     mailerConfig
+	activation handler.KeyedLimit
+	auth       handler.Auth
+	lockout    handler.Lockout
+	deletion   handler.AccountDeletion
+	roles      rolesConfig
+	jwt        jwtConfig
+	oidc       oidcConfig
+	passwords  passwordsConfig
+}
+
+type passwordsConfig struct {
+	policy    data.PasswordPolicy
+	blocklist string
+}
+
+type oidcConfig struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       string
+	keysTTL      time.Duration
+}
+
+type rolesConfig struct {
+	defaultRole string
+}
+
+type jwtConfig struct {
+	mode           string
+	jwks           string
+	kid            string
+	issuer         string
+	audience       string
+	reloadInterval time.Duration
+}
+
+type mailerConfig struct {
+	transport string
+	dir       string
+	sender    string
+	retries   int
+	smtp      smtpConfig
+}
+
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+	timeout  time.Duration
+}
+
+type statsConfig struct {
+	ttl time.Duration
 }
 
 type corsConfig struct {
@@ -43,9 +103,65 @@ func initConfig(version string) config {
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "PostgreSQL max connection idle time")
 
-	flag.Float64Var(&cfg.limiter.Rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
-	flag.IntVar(&cfg.limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
-	flag.BoolVar(&cfg.limiter.Enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.middleware.Limiter.Rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.middleware.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.BoolVar(&cfg.middleware.Limiter.Enabled, "limiter-enabled", true, "Enable rate limiter")
+
+	flag.Float64Var(&cfg.similar.Genre, "similar-genre-weight", 0.6, "Similar movies genre overlap weight")
+	flag.Float64Var(&cfg.similar.Year, "similar-year-weight", 0.25, "Similar movies year proximity weight")
+	flag.Float64Var(&cfg.similar.Runtime, "similar-runtime-weight", 0.15, "Similar movies runtime similarity weight")
+
+	flag.DurationVar(&cfg.middleware.Idempotency.TTL, "idempotency-ttl", 24*time.Hour, "Idempotency key retention period")
+
+	flag.DurationVar(&cfg.auth.AccessTTL, "auth-access-ttl", 15*time.Minute, "Authentication access token lifetime")
+	flag.DurationVar(&cfg.auth.RefreshTTL, "auth-refresh-ttl", 30*24*time.Hour, "Authentication refresh token lifetime")
+	flag.DurationVar(&cfg.auth.ChallengeTTL, "auth-challenge-ttl", 5*time.Minute, "Two-factor challenge token lifetime")
+	flag.StringVar(&cfg.auth.TOTPIssuer, "auth-totp-issuer", "Greenlight", "Issuer shown by authenticator apps")
+	flag.StringVar(&cfg.jwt.mode, "auth-mode", "stateful", "Access token mode (stateful|jwt)")
+	flag.StringVar(&cfg.jwt.jwks, "jwt-jwks", "", "Path to the local JWKS file holding the JWT keys")
+	flag.StringVar(&cfg.jwt.kid, "jwt-kid", "", "Key ID of the JWKS key used to sign new JWTs")
+	flag.StringVar(&cfg.jwt.issuer, "jwt-issuer", "greenlight", "JWT issuer claim")
+	flag.StringVar(&cfg.jwt.audience, "jwt-audience", "greenlight-api", "JWT audience claim")
+	flag.DurationVar(&cfg.jwt.reloadInterval, "jwt-reload-interval", time.Minute, "Interval between JWKS file change checks (0 disables)")
+	flag.StringVar(&cfg.oidc.issuer, "oidc-issuer", "", "OpenID Connect issuer URL used for single sign-on (empty disables)")
+	flag.StringVar(&cfg.oidc.clientID, "oidc-client-id", "", "OpenID Connect client ID")
+	flag.StringVar(&cfg.oidc.clientSecret, "oidc-client-secret", "", "OpenID Connect client secret (empty for public clients)")
+	flag.StringVar(&cfg.oidc.redirectURL, "oidc-redirect-url", "", "URL the identity provider redirects users back to")
+	flag.StringVar(&cfg.oidc.scopes, "oidc-scopes", "openid email profile", "OpenID Connect scopes (space separated)")
+	flag.DurationVar(&cfg.oidc.keysTTL, "oidc-jwks-ttl", time.Hour, "Identity provider JWKS cache TTL")
+	flag.DurationVar(&cfg.auth.OIDCStateTTL, "oidc-state-ttl", 10*time.Minute, "Time allowed to complete a single sign-on")
+	flag.DurationVar(&cfg.middleware.SessionTouch, "session-touch-interval", 5*time.Minute, "Minimum interval between session last-used updates")
+	flag.DurationVar(&cfg.middleware.PermissionsTTL, "permissions-cache-ttl", time.Minute, "User permissions and suspension cache TTL (0 disables)")
+
+	flag.DurationVar(&cfg.stats.ttl, "stats-cache-ttl", 5*time.Minute, "Catalogue statistics cache TTL")
+
+	flag.StringVar(&cfg.mailer.transport, "mailer-transport", "smtp", "Mailer transport (smtp|file|stdout, stdout only in development)")
+	flag.StringVar(&cfg.mailer.dir, "mailer-dir", "./tmp/mail", "Directory the file mailer transport writes emails to")
+	flag.StringVar(&cfg.mailer.sender, "mailer-sender", "Greenlight <no-reply@greenlight.hvpaiva.dev>", "Mailer sender address")
+	flag.IntVar(&cfg.mailer.retries, "mailer-retries", 3, "Mailer maximum send attempts")
+	flag.StringVar(&cfg.mailer.smtp.host, "smtp-host", "", "SMTP host")
+	flag.IntVar(&cfg.mailer.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.mailer.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.mailer.smtp.password, "smtp-password", "", "SMTP password")
+	flag.DurationVar(&cfg.mailer.smtp.timeout, "smtp-timeout", 10*time.Second, "SMTP connection timeout")
+
+	flag.DurationVar(&cfg.activation.Every, "activation-limiter-every", 5*time.Minute, "Interval between activation token requests per email address")
+	flag.IntVar(&cfg.activation.Burst, "activation-limiter-burst", 3, "Activation token requests burst per email address")
+
+	flag.IntVar(&cfg.lockout.AccountThreshold, "lockout-account-threshold", 5, "Failed logins before an account is locked out (0 disables)")
+	flag.IntVar(&cfg.lockout.IPThreshold, "lockout-ip-threshold", 20, "Failed logins before a client IP is locked out (0 disables)")
+	flag.DurationVar(&cfg.lockout.BaseDelay, "lockout-base-delay", time.Second, "Delay after the first failed login, doubled on every failure")
+	flag.DurationVar(&cfg.lockout.Duration, "lockout-duration", 15*time.Minute, "Lockout duration once the threshold is reached")
+	flag.DurationVar(&cfg.lockout.Window, "lockout-window", time.Hour, "Period without failures after which failed logins are forgotten")
+
+	flag.DurationVar(&cfg.deletion.Grace, "account-deletion-grace", 30*24*time.Hour, "Period during which a deleted account can still be recovered")
+	flag.DurationVar(&cfg.deletion.PurgeInterval, "account-purge-interval", time.Hour, "Interval between purges of deleted accounts (0 disables)")
+
+	flag.Float64Var(&cfg.passwords.policy.MinEntropy, "password-min-entropy", 35, "Minimum estimated password strength in bits (0 disables)")
+	flag.BoolVar(&cfg.passwords.policy.BanPersonal, "password-ban-personal", true, "Reject passwords containing the user name or email address")
+	flag.StringVar(&cfg.passwords.blocklist, "password-blocklist", "", "Path to a file listing compromised passwords, one per line")
+
+	flag.StringVar(&cfg.roles.defaultRole, "default-role", "viewer", "Role assigned to newly registered users (empty for none)")
 
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
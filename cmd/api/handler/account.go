@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+// AccountDeletion configures how long deleted accounts can still be recovered and how
+// often the ones past that period are purged.
+type AccountDeletion struct {
+	Grace         time.Duration
+	PurgeInterval time.Duration
+}
+
+func (h *Handler) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	var output struct {
+		ExportedAt         time.Time        `json:"exported_at"`
+		User               *data.User       `json:"user"`
+		DeleteAfter        *time.Time       `json:"delete_after"`
+		PendingEmailChange *data.Email      `json:"pending_email_change"`
+		Roles              []string         `json:"roles"`
+		Permissions        data.Permissions `json:"permissions"`
+		Sessions           []*data.Session  `json:"sessions"`
+		APIKeys            []*data.APIKey   `json:"api_keys"`
+		TagVotes           []*data.TagVote  `json:"tag_votes"`
+		Movies             []*data.Movie    `json:"movies"`
+		Identities         []*data.Identity `json:"identities"`
+	}
+	output.ExportedAt = time.Now().UTC()
+	output.User = user
+
+	if output.DeleteAfter, err = h.Models.Users.GetDeleteAfter(user.ID); err != nil {
+		return erro.ThrowInternalServer("get user deletion", err)
+	}
+
+	email, err := h.Models.EmailChanges.Get(user.ID)
+	switch {
+	case err == nil:
+		output.PendingEmailChange = &email
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return erro.ThrowInternalServer("get email change", err)
+	}
+
+	if output.Roles, err = h.Models.Roles.GetAllForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("get user roles", err)
+	}
+
+	if output.Permissions, err = h.Models.Permission.GetAllForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("get user permissions", err)
+	}
+
+	if output.Sessions, err = h.Models.Tokens.GetSessionsForUser(user.ID, data.TokenHash(h.App.ContextGetToken(r))); err != nil {
+		return erro.ThrowInternalServer("get user sessions", err)
+	}
+
+	if output.APIKeys, err = h.Models.APIKeys.GetAllForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("get user api keys", err)
+	}
+
+	if output.TagVotes, err = h.Models.Tags.GetVotesForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("get user tag votes", err)
+	}
+
+	if output.Movies, err = h.Models.Movies.GetAllCreatedBy(user.ID); err != nil {
+		return erro.ThrowInternalServer("get user movies", err)
+	}
+
+	if output.Identities, err = h.Models.OIDC.GetIdentitiesForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("get user identities", err)
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="greenlight-export-%d.json"`, user.ID))
+
+	if err = ujson.Write(w, http.StatusOK, output, headers); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidatePassword(v, input.Password); !v.Valid() {
+		return erro.NewValidationErr("password validation", v.Errors)
+	}
+
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	if user.ServiceAccount {
+		return erro.Forbidden.WithMessage("service accounts are deleted by an administrator")
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		return erro.ThrowInternalServer("matching password", err)
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		return erro.NewValidationErr("password validation", v.Errors)
+	}
+
+	deleteAfter := time.Now().Add(h.Config.Deletion.Grace).Truncate(time.Second)
+
+	if err = h.Models.Users.ScheduleDeletion(user.ID, deleteAfter); err != nil {
+		return erro.ThrowInternalServer("schedule user deletion", err)
+	}
+
+	h.sendMail(string(user.Email), "account_deletion.tmpl", map[string]any{
+		"deleteAfter": deleteAfter.UTC().Format(time.RFC1123),
+	})
+
+	var output struct {
+		Message     string    `json:"message"`
+		DeleteAfter time.Time `json:"delete_after"`
+	}
+	output.Message = "your account is scheduled for deletion, you can cancel it until then"
+	output.DeleteAfter = deleteAfter
+
+	if err = ujson.Write(w, http.StatusAccepted, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) cancelCurrentUserDeletionHandler(w http.ResponseWriter, r *http.Request) error {
+	user := h.App.ContextGetUser(r)
+
+	if err := h.Models.Users.CancelDeletion(user.ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("your account is not scheduled for deletion")
+		default:
+			return erro.ThrowInternalServer("cancel user deletion", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) purgeDeletedUsers() error {
+	deleted, err := h.Models.Users.DeleteScheduled()
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 {
+		h.App.Logger.Info("purged deleted accounts", "count", deleted)
+	}
+
+	return nil
+}
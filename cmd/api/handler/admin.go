@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/filters"
+	"github.com/hvpaiva/greenlight/pkg/query"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) adminShowUsersHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Email string
+		Name  string
+		filters.Filter
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Email = query.ReadString(qs, "email", "")
+	input.Name = query.ReadString(qs, "name", "")
+
+	input.Page = query.ReadInt(qs, "page", 1, v)
+	input.PageSize = query.ReadInt(qs, "page_size", 20, v)
+	input.Sort = query.ReadString(qs, "sort", "id")
+	input.SortSafeList = []string{"id", "email", "name", "created_at", "-id", "-email", "-name", "-created_at"}
+
+	if input.Filter.Validate(v); !v.Valid() {
+		return erro.NewValidationErr("filter validation", v.Errors)
+	}
+
+	users, metadata, err := h.Models.Users.GetAll(input.Email, input.Name, input.Filter)
+	if err != nil {
+		return erro.ThrowInternalServer("get all users", err)
+	}
+
+	var output struct {
+		Metadata filters.Metadata `json:"metadata"`
+		Users    []*data.User     `json:"users"`
+	}
+	output.Users = users
+	output.Metadata = metadata
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) adminGetUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	return h.writeAdminUser(w, user)
+}
+
+func (h *Handler) adminUpdateUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	if r.Header.Get("X-Expected-Version") != "" {
+		if strconv.Itoa(user.Version) != r.Header.Get("X-Expected-Version") {
+			return erro.Conflict.WithMessage("the expected version does not match the current version of the user")
+		}
+	}
+
+	var input struct {
+		Activated *bool `json:"activated"`
+		Suspended *bool `json:"suspended"`
+	}
+
+	if err = ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	if input.Suspended != nil && *input.Suspended && user.ID == h.App.ContextGetUser(r).ID {
+		return erro.Forbidden.WithMessage("you cannot suspend your own account")
+	}
+
+	suspending := input.Suspended != nil && *input.Suspended && !user.Suspended
+
+	if input.Activated != nil {
+		user.Activated = *input.Activated
+	}
+
+	if input.Suspended != nil {
+		user.Suspended = *input.Suspended
+	}
+
+	if err = h.Models.Users.Update(user); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Conflict.WithMessage("error while updating user due to a conflict, please try again")
+		default:
+			return erro.ThrowInternalServer("update user", err)
+		}
+	}
+
+	if suspending {
+		if err = h.Models.Tokens.DeleteAllScopesForUser(user.ID); err != nil {
+			return erro.ThrowInternalServer("delete user tokens", err)
+		}
+	}
+
+	if input.Suspended != nil {
+		h.Middleware.InvalidatePermissions(user.ID)
+	}
+
+	return h.writeAdminUser(w, user)
+}
+
+// adminResetUserPasswordHandler replaces the password of the user with an unusable one,
+// signs the user out everywhere and emails a password reset token.
+func (h *Handler) adminResetUserPasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	if user.ServiceAccount {
+		return erro.Forbidden.WithMessage("service accounts authenticate with api keys")
+	}
+
+	if err = user.Password.SetRandom(); err != nil {
+		return erro.ThrowInternalServer("setting password", err)
+	}
+
+	if err = h.Models.Users.Update(user); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Conflict.WithMessage("error while updating user due to a conflict, please try again")
+		default:
+			return erro.ThrowInternalServer("update user", err)
+		}
+	}
+
+	if err = h.Models.Tokens.DeleteAllScopesForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	token, err := h.Models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		return erro.ThrowInternalServer("create token", err)
+	}
+
+	h.sendMail(string(user.Email), "password_reset.tmpl", map[string]any{
+		"passwordResetToken": token.Plaintext,
+	})
+
+	var output struct {
+		Message string `json:"message"`
+	}
+	output.Message = "the password was reset and a password reset token was sent to the user"
+
+	if err = ujson.Write(w, http.StatusAccepted, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) adminDeleteUserTokensHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	if err = h.Models.Tokens.DeleteAllScopesForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) userFromParams(r *http.Request) (*data.User, error) {
+	id, err := parseId(r)
+	if err != nil {
+		return nil, erro.Throw(erro.BadRequest.WithMessage("invalid id"), erro.Cause("parsing id", err))
+	}
+
+	user, err := h.Models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, erro.NotFound.WithMessage("the user you are looking for does not exist")
+		default:
+			return nil, erro.ThrowInternalServer("get user", err)
+		}
+	}
+
+	return user, nil
+}
+
+// writeAdminUser responds with the user along with its version, which admins send back in
+// the X-Expected-Version header to update it.
+func (h *Handler) writeAdminUser(w http.ResponseWriter, user *data.User) error {
+	permissions, err := h.Models.Permission.GetAllForUser(user.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("get user permissions", err)
+	}
+
+	var output struct {
+		User        *data.User       `json:"user"`
+		Version     int              `json:"version"`
+		Permissions data.Permissions `json:"permissions"`
+	}
+	output.User = user
+	output.Version = user.Version
+	output.Permissions = permissions
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
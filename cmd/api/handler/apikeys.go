@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) createServiceAccountHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Name        string   `json:"name"`
+		Email       string   `json:"email"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	user := &data.User{
+		Name:           input.Name,
+		Email:          data.Email(input.Email),
+		Activated:      true,
+		ServiceAccount: true,
+	}
+
+	v := validator.New()
+
+	user.Validate(v)
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+
+	if !v.Valid() {
+		return erro.NewValidationErr("service account validation", v.Errors)
+	}
+
+	if err := h.checkPermissionCodes(v, input.Permissions); err != nil {
+		return err
+	}
+
+	err := h.Models.Users.Insert(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "user with this email address already exists")
+			return erro.NewValidationErr("user insert", v.Errors)
+		default:
+			return erro.ThrowInternalServer("user insert", err)
+		}
+	}
+
+	if len(input.Permissions) > 0 {
+		if _, err = h.Models.Permission.GrantForUser(h.App.ContextGetUser(r).ID, user.ID, input.Permissions...); err != nil {
+			return erro.ThrowInternalServer("grant permissions", err)
+		}
+	}
+
+	var output struct {
+		User        *data.User `json:"user"`
+		Permissions []string   `json:"permissions"`
+	}
+	output.User = user
+	output.Permissions = input.Permissions
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/users/%d", user.ID))
+
+	if err = ujson.Write(w, http.StatusCreated, output, headers); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Name        string     `json:"name"`
+		ExpiresAt   *time.Time `json:"expires_at"`
+		Permissions []string   `json:"permissions"`
+	}
+
+	if err = ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if v.Check(user.ServiceAccount, "user", "api keys can only be issued to service accounts"); !v.Valid() {
+		return erro.NewValidationErr("api key validation", v.Errors)
+	}
+
+	key, err := data.GenerateAPIKey(user.ID, input.Name, input.ExpiresAt, input.Permissions)
+	if err != nil {
+		return erro.ThrowInternalServer("generate api key", err)
+	}
+
+	if key.Validate(v); !v.Valid() {
+		return erro.NewValidationErr("api key validation", v.Errors)
+	}
+
+	userPermissions, err := h.Models.Permission.GetAllForUser(user.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("get user permissions", err)
+	}
+
+	for _, permission := range key.Permissions {
+		v.Check(userPermissions.Contains(permission), "permissions", fmt.Sprintf("the service account does not hold %q", permission))
+	}
+
+	if !v.Valid() {
+		return erro.NewValidationErr("api key validation", v.Errors)
+	}
+
+	if err = h.Models.APIKeys.Insert(key); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAPIKeyName):
+			v.AddError("name", "an api key with this name already exists for the service account")
+			return erro.NewValidationErr("api key insert", v.Errors)
+		default:
+			return erro.ThrowInternalServer("api key insert", err)
+		}
+	}
+
+	var output struct {
+		APIKey *data.APIKey `json:"api_key"`
+	}
+	output.APIKey = key
+
+	if err = ujson.Write(w, http.StatusCreated, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) showAPIKeysHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	keys, err := h.Models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("get api keys", err)
+	}
+
+	var output struct {
+		APIKeys []*data.APIKey `json:"api_keys"`
+	}
+	output.APIKeys = keys
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) deleteAPIKeyHandler(w http.ResponseWriter, r *http.Request) error {
+	userID, err := parseId(r)
+	if err != nil {
+		return erro.Throw(erro.BadRequest.WithMessage("invalid id"), erro.Cause("parsing id", err))
+	}
+
+	keyID, err := parseIdParam(r, "key_id")
+	if err != nil {
+		return erro.Throw(erro.BadRequest.WithMessage("invalid key id"), erro.Cause("parsing key id", err))
+	}
+
+	if err = h.Models.APIKeys.Delete(userID, keyID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the api key you are looking for does not exist")
+		default:
+			return erro.ThrowInternalServer("delete api key", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// checkPermissionCodes returns a validation error when any of the codes is not a known permission.
+func (h *Handler) checkPermissionCodes(v *validator.Validator, codes []string) error {
+	known, err := h.Models.Permission.GetAll()
+	if err != nil {
+		return erro.ThrowInternalServer("get permissions", err)
+	}
+
+	for _, code := range codes {
+		v.Check(known.Contains(code), "permissions", fmt.Sprintf("unknown permission %q", code))
+	}
+
+	if !v.Valid() {
+		return erro.NewValidationErr("permission validation", v.Errors)
+	}
+
+	return nil
+}
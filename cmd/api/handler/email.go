@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePassword(v, input.Password)
+
+	if !v.Valid() {
+		return erro.NewValidationErr("email change validation", v.Errors)
+	}
+
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	if user.ServiceAccount {
+		return erro.Forbidden.WithMessage("service accounts cannot change their email address")
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		return erro.ThrowInternalServer("matching password", err)
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		return erro.NewValidationErr("email change validation", v.Errors)
+	}
+
+	if strings.EqualFold(input.Email, string(user.Email)) {
+		v.AddError("email", "must be different from the current email address")
+		return erro.NewValidationErr("email change validation", v.Errors)
+	}
+
+	_, err = h.Models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		return erro.NewValidationErr("email change validation", v.Errors)
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return erro.ThrowInternalServer("get user by email", err)
+	}
+
+	if err = h.Models.EmailChanges.Set(user.ID, input.Email); err != nil {
+		return erro.ThrowInternalServer("set email change", err)
+	}
+
+	if err = h.Models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	token, err := h.Models.Tokens.New(user.ID, 24*time.Hour, data.ScopeEmailChange)
+	if err != nil {
+		return erro.ThrowInternalServer("create token", err)
+	}
+
+	h.sendMail(input.Email, "email_change.tmpl", map[string]any{
+		"emailChangeToken": token.Plaintext,
+	})
+
+	var output struct {
+		Message string `json:"message"`
+	}
+	output.Message = "a confirmation token was sent to the new email address"
+
+	if err = ujson.Write(w, http.StatusAccepted, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidateToken(v, input.TokenPlaintext); !v.Valid() {
+		return erro.NewValidationErr("token validation", v.Errors)
+	}
+
+	user, err := h.Models.Users.GetForToken(data.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired token")
+			return erro.NewValidationErr("get user by token", v.Errors)
+		default:
+			return erro.ThrowInternalServer("get user by token", err)
+		}
+	}
+
+	email, err := h.Models.EmailChanges.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired token")
+			return erro.NewValidationErr("get email change", v.Errors)
+		default:
+			return erro.ThrowInternalServer("get email change", err)
+		}
+	}
+
+	previous := user.Email
+	user.Email = email
+
+	err = h.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			return erro.NewValidationErr("update user", v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Throw(erro.Conflict, erro.Cause("update user", err))
+		default:
+			return erro.ThrowInternalServer("update user", err)
+		}
+	}
+
+	for _, scope := range []string{data.ScopeEmailChange, data.ScopePasswordReset} {
+		if err = h.Models.Tokens.DeleteAllForUser(scope, user.ID); err != nil {
+			return erro.ThrowInternalServer("delete user tokens", err)
+		}
+	}
+
+	if err = h.Models.EmailChanges.Delete(user.ID); err != nil {
+		return erro.ThrowInternalServer("delete email change", err)
+	}
+
+	h.sendMail(string(previous), "email_changed.tmpl", map[string]any{
+		"newEmail": user.Email,
+	})
+
+	if err = ujson.Write(w, http.StatusOK, user, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
@@ -3,11 +3,15 @@ package handler
 import (
 	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/hvpaiva/greenlight/cmd/api/app"
 	"github.com/hvpaiva/greenlight/cmd/api/erro"
 	"github.com/hvpaiva/greenlight/cmd/api/middleware"
+	"github.com/hvpaiva/greenlight/internal/auth"
 	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/internal/mailer"
+	"github.com/hvpaiva/greenlight/pkg/cache"
 )
 
 type handlerFunc func(http.ResponseWriter, *http.Request) error
@@ -16,15 +20,71 @@ type Handler struct {
 	App        *app.Application
 	Middleware *middleware.Middleware
 	Models     *data.Models
+	Mailer     *mailer.Mailer
+	Config     Config
+	statsCache *cache.Cache[string, *data.MovieStats]
+
+	activationLimiter *keyedLimiter
+	challengeLimiter  *keyedLimiter
+}
+
+type Config struct {
+	Middleware  middleware.Config
+	Similar     data.SimilarityWeights
+	StatsTTL    time.Duration
+	MailRetry   int
+	Activation  KeyedLimit
+	Auth        Auth
+	Lockout     Lockout
+	Deletion    AccountDeletion
+	DefaultRole string
+	Passwords   data.PasswordPolicy
 }
 
-func New(app *app.Application, db *sql.DB, limiter *middleware.Limiter) *Handler {
+type Auth struct {
+	AccessTTL    time.Duration
+	RefreshTTL   time.Duration
+	ChallengeTTL time.Duration
+	TOTPIssuer   string
+	JWT          *auth.JWT
+	OIDC         *auth.OIDC
+	OIDCStateTTL time.Duration
+}
+
+func New(app *app.Application, db *sql.DB, mailer *mailer.Mailer, cfg Config) *Handler {
 	models := data.New(db)
-	return &Handler{
+	h := &Handler{
 		App:        app,
-		Middleware: middleware.New(app, models, limiter),
+		Middleware: middleware.New(app, models, cfg.Middleware),
 		Models:     models,
+		Mailer:     mailer,
+		Config:     cfg,
+		statsCache: cache.New[string, *data.MovieStats](cfg.StatsTTL),
+
+		activationLimiter: newKeyedLimiter(cfg.Activation),
+		challengeLimiter:  newKeyedLimiter(KeyedLimit{Every: time.Minute, Burst: 5}),
+	}
+
+	if cfg.StatsTTL > 0 {
+		app.Schedule("evict stats cache", cfg.StatsTTL, func() error {
+			h.statsCache.DeleteExpired()
+			return nil
+		})
+	}
+
+	app.Schedule("delete stale login throttles", time.Hour, func() error {
+		return h.Models.Throttles.DeleteStale(h.Config.Lockout.Window)
+	})
+
+	if cfg.Auth.OIDC != nil {
+		app.Schedule("delete expired oidc authorizations", time.Hour, h.Models.OIDC.DeleteExpiredAuthorizations)
 	}
+
+	if cfg.Deletion.PurgeInterval > 0 {
+		app.Schedule("purge deleted accounts", cfg.Deletion.PurgeInterval, h.purgeDeletedUsers)
+	}
+
+	return h
 }
 
 func (h *Handler) adapt(handler handlerFunc) http.Handler {
@@ -34,3 +94,21 @@ func (h *Handler) adapt(handler handlerFunc) http.Handler {
 		}
 	})
 }
+
+func (h *Handler) sendMail(recipient, templateFile string, data any) {
+	h.App.Background(func() {
+		var err error
+
+		for attempt := 1; attempt <= h.Config.MailRetry; attempt++ {
+			if err = h.Mailer.Send(recipient, templateFile, data); err == nil {
+				return
+			}
+
+			h.App.Logger.Warn("failed to send email", "template", templateFile, "attempt", attempt, "error", err.Error())
+
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+
+		h.App.Logger.Error("giving up sending email", "template", templateFile, "error", err.Error())
+	})
+}
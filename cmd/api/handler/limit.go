@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type KeyedLimit struct {
+	Every time.Duration
+	Burst int
+}
+
+// keyedLimiter rate limits by an arbitrary key, such as an email address, instead of
+// the client IP used by the global rate limiter.
+type keyedLimiter struct {
+	mu      sync.Mutex
+	limit   KeyedLimit
+	clients map[string]*limitedClient
+}
+
+type limitedClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newKeyedLimiter(limit KeyedLimit) *keyedLimiter {
+	l := &keyedLimiter{
+		limit:   limit,
+		clients: make(map[string]*limitedClient),
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			l.mu.Lock()
+
+			for key, client := range l.clients {
+				if time.Since(client.lastSeen) > l.limit.Every*time.Duration(l.limit.Burst) {
+					delete(l.clients, key)
+				}
+			}
+
+			l.mu.Unlock()
+		}
+	}()
+
+	return l
+}
+
+func (l *keyedLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, found := l.clients[key]; !found {
+		l.clients[key] = &limitedClient{limiter: rate.NewLimiter(rate.Every(l.limit.Every), l.limit.Burst)}
+	}
+
+	l.clients[key].lastSeen = time.Now()
+
+	return l.clients[key].limiter.Allow()
+}
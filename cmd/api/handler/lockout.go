@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+)
+
+// Lockout configures how failed logins are throttled. Every failure of an account or IP
+// blocks further attempts for an exponentially growing delay, starting at BaseDelay,
+// until the threshold is reached and the subject is locked for Duration. Failures are
+// forgotten after Window without any. A threshold lower than one disables the tracking.
+type Lockout struct {
+	AccountThreshold int
+	IPThreshold      int
+	BaseDelay        time.Duration
+	Duration         time.Duration
+	Window           time.Duration
+}
+
+func (l Lockout) delay(failures, threshold int) time.Duration {
+	if failures >= threshold {
+		return l.Duration
+	}
+
+	delay := l.BaseDelay << (failures - 1)
+	if delay > l.Duration || delay <= 0 {
+		return l.Duration
+	}
+
+	return delay
+}
+
+// checkLoginThrottle rejects the login when the account or the client IP is blocked,
+// telling the client how long to wait.
+func (h *Handler) checkLoginThrottle(w http.ResponseWriter, email, ip string) error {
+	until, err := h.Models.Throttles.BlockedUntil(strings.ToLower(email), ip)
+	if err != nil {
+		return erro.ThrowInternalServer("get login throttle", err)
+	}
+
+	if until.IsZero() {
+		return nil
+	}
+
+	retryAfter := int(time.Until(until).Round(time.Second).Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	return erro.TooManyRequests.WithMessage("too many failed login attempts, please try again later")
+}
+
+// recordLoginFailure counts a failed login against both the account and the client IP.
+func (h *Handler) recordLoginFailure(email, ip string) {
+	lockout := h.Config.Lockout
+
+	subjects := []struct {
+		kind      string
+		subject   string
+		threshold int
+	}{
+		{data.ThrottleAccount, strings.ToLower(email), lockout.AccountThreshold},
+		{data.ThrottleIP, ip, lockout.IPThreshold},
+	}
+
+	for _, s := range subjects {
+		if s.threshold < 1 {
+			continue
+		}
+
+		failures, err := h.Models.Throttles.RecordFailure(s.kind, s.subject, lockout.Window)
+		if err != nil {
+			h.App.Logger.Error("failed to record login failure", "kind", s.kind, "error", err.Error())
+			continue
+		}
+
+		until := time.Now().Add(lockout.delay(failures, s.threshold))
+
+		if err = h.Models.Throttles.Block(s.kind, s.subject, until); err != nil {
+			h.App.Logger.Error("failed to block login", "kind", s.kind, "error", err.Error())
+		}
+
+		if failures == s.threshold {
+			h.App.Logger.Warn("login locked out", "kind", s.kind, "subject", s.subject, "failures", failures)
+		}
+	}
+}
+
+// resetLoginFailures forgets the failures of the account after a successful login. The
+// failures of the IP are kept, so a single valid account cannot be used to reset them.
+func (h *Handler) resetLoginFailures(email string) {
+	err := h.Models.Throttles.Reset(data.ThrottleAccount, strings.ToLower(email))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		h.App.Logger.Error("failed to reset login failures", "error", err.Error())
+	}
+}
+
+func (h *Handler) showLockoutsHandler(w http.ResponseWriter, r *http.Request) error {
+	throttles, err := h.Models.Throttles.GetAllBlocked()
+	if err != nil {
+		return erro.ThrowInternalServer("get blocked logins", err)
+	}
+
+	var output struct {
+		Lockouts []*data.LoginThrottle `json:"lockouts"`
+	}
+	output.Lockouts = throttles
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) unlockUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	if err = h.Models.Throttles.Reset(data.ThrottleAccount, strings.ToLower(string(user.Email))); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the user has no failed logins")
+		default:
+			return erro.ThrowInternalServer("reset login failures", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/hvpaiva/greenlight/cmd/api/erro"
 	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/internal/policy"
 	"github.com/hvpaiva/greenlight/pkg/filters"
 	"github.com/hvpaiva/greenlight/pkg/query"
 	"github.com/hvpaiva/greenlight/pkg/ujson"
@@ -51,11 +52,14 @@ func (h *Handler) createMovieHandler(w http.ResponseWriter, r *http.Request) err
 		return erro.BadRequest.WithMessage(err.Error())
 	}
 
+	user := h.App.ContextGetUser(r)
+
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:     input.Title,
+		Year:      input.Year,
+		Runtime:   input.Runtime,
+		Genres:    input.Genres,
+		CreatedBy: &user.ID,
 	}
 
 	v := validator.New()
@@ -95,6 +99,10 @@ func (h *Handler) updateMovieHandler(w http.ResponseWriter, r *http.Request) err
 		}
 	}
 
+	if err = h.authorizeRecord(r, policy.MovieWrite, movie); err != nil {
+		return err
+	}
+
 	if r.Header.Get("X-Expected-Version") != "" {
 		if strconv.Itoa(int(movie.Version)) != r.Header.Get("X-Expected-Version") {
 			return erro.Conflict.WithMessage("the expected version does not match the current version of the movie")
@@ -117,6 +125,8 @@ func (h *Handler) updateMovieHandler(w http.ResponseWriter, r *http.Request) err
 	movie.Runtime = input.Runtime
 	movie.Genres = input.Genres
 
+	movie.UpdatedBy = &h.App.ContextGetUser(r).ID
+
 	v := validator.New()
 
 	if movie.Validate(v); !v.Valid() {
@@ -155,6 +165,10 @@ func (h *Handler) patchMovieHandler(w http.ResponseWriter, r *http.Request) erro
 		}
 	}
 
+	if err = h.authorizeRecord(r, policy.MovieWrite, movie); err != nil {
+		return err
+	}
+
 	if r.Header.Get("X-Expected-Version") != "" {
 		if strconv.Itoa(int(movie.Version)) != r.Header.Get("X-Expected-Version") {
 			return erro.Conflict.WithMessage("the expected version does not match the current version of the movie")
@@ -188,6 +202,8 @@ func (h *Handler) patchMovieHandler(w http.ResponseWriter, r *http.Request) erro
 		movie.Genres = input.Genres
 	}
 
+	movie.UpdatedBy = &h.App.ContextGetUser(r).ID
+
 	v := validator.New()
 
 	if movie.Validate(v); !v.Valid() {
@@ -216,6 +232,20 @@ func (h *Handler) deleteMovieHandler(w http.ResponseWriter, r *http.Request) err
 		return erro.Throw(erro.BadRequest.WithMessage("invalid id"), erro.Cause("parsing id", err))
 	}
 
+	movie, err := h.Models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the movie you are looking for does not exist")
+		default:
+			return erro.ThrowInternalServer("get movie", err)
+		}
+	}
+
+	if err = h.authorizeRecord(r, policy.MovieWrite, movie); err != nil {
+		return err
+	}
+
 	err = h.Models.Movies.Delete(id)
 	if err != nil {
 		switch {
@@ -235,6 +265,7 @@ func (h *Handler) showMoviesHandler(w http.ResponseWriter, r *http.Request) erro
 	var input struct {
 		Title  string
 		Genres []string
+		Tags   []string
 		filters.Filter
 	}
 
@@ -244,6 +275,14 @@ func (h *Handler) showMoviesHandler(w http.ResponseWriter, r *http.Request) erro
 
 	input.Title = query.ReadString(qs, "title", "")
 	input.Genres = query.ReadCSV(qs, "genres", []string{})
+	input.Tags = query.ReadCSV(qs, "tags", []string{})
+
+	for i := range input.Tags {
+		input.Tags[i] = data.NormalizeTag(input.Tags[i])
+	}
+
+	v.Check(len(input.Tags) <= 10, "tags", "must not contain more than 10 tags")
+	v.Check(validator.Unique(input.Tags), "tags", "must not contain duplicate values")
 
 	input.Page = query.ReadInt(qs, "page", 1, v)
 	input.PageSize = query.ReadInt(qs, "page_size", 20, v)
@@ -254,7 +293,7 @@ func (h *Handler) showMoviesHandler(w http.ResponseWriter, r *http.Request) erro
 		return erro.NewValidationErr("filter validation", v.Errors)
 	}
 
-	movies, metadata, err := h.Models.Movies.GetAll(input.Title, input.Genres, input.Filter)
+	movies, metadata, err := h.Models.Movies.GetAll(input.Title, input.Genres, input.Tags, input.Filter)
 	if err != nil {
 		return erro.ThrowInternalServer("get all movies", err)
 	}
@@ -273,10 +312,65 @@ func (h *Handler) showMoviesHandler(w http.ResponseWriter, r *http.Request) erro
 	return nil
 }
 
+func (h *Handler) similarMoviesHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseId(r)
+	if err != nil {
+		return erro.Throw(erro.BadRequest.WithMessage("invalid id"), erro.Cause("parsing id", err))
+	}
+
+	var input struct {
+		filters.Filter
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Page = query.ReadInt(qs, "page", 1, v)
+	input.PageSize = query.ReadInt(qs, "page_size", 20, v)
+	input.Sort = query.ReadString(qs, "sort", "-score")
+	input.SortSafeList = []string{"-score", "score"}
+
+	if input.Filter.Validate(v); !v.Valid() {
+		return erro.NewValidationErr("filter validation", v.Errors)
+	}
+
+	if _, err = h.Models.Movies.Get(id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the movie you are looking for does not exist")
+		default:
+			return erro.ThrowInternalServer("get movie", err)
+		}
+	}
+
+	movies, metadata, err := h.Models.Movies.GetSimilar(id, h.Config.Similar, input.Filter)
+	if err != nil {
+		return erro.ThrowInternalServer("get similar movies", err)
+	}
+
+	var output struct {
+		Metadata filters.Metadata     `json:"metadata"`
+		Movies   []*data.SimilarMovie `json:"movies"`
+	}
+	output.Movies = movies
+	output.Metadata = metadata
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
 func parseId(r *http.Request) (int64, error) {
+	return parseIdParam(r, "id")
+}
+
+func parseIdParam(r *http.Request, name string) (int64, error) {
 	param := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(param.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(param.ByName(name), 10, 64)
 	if err != nil {
 		return 0, fmt.Errorf("error while parsing id from params: %s", err.Error())
 	}
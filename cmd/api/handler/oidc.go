@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/auth"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) createOIDCAuthorizationHandler(w http.ResponseWriter, r *http.Request) error {
+	if h.Config.Auth.OIDC == nil {
+		return erro.NotFound.WithMessage("single sign-on is not enabled")
+	}
+
+	authorization, err := h.Config.Auth.OIDC.Authorize(r.Context())
+	if err != nil {
+		return erro.ThrowInternalServer("start oidc authorization", err)
+	}
+
+	err = h.Models.OIDC.InsertAuthorization(authorization.State, authorization.Nonce, authorization.Verifier, h.Config.Auth.OIDCStateTTL)
+	if err != nil {
+		return erro.ThrowInternalServer("insert oidc authorization", err)
+	}
+
+	var output struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	output.AuthorizationURL = authorization.URL
+
+	if err = ujson.Write(w, http.StatusCreated, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) createOIDCAuthTokenHandler(w http.ResponseWriter, r *http.Request) error {
+	if h.Config.Auth.OIDC == nil {
+		return erro.NotFound.WithMessage("single sign-on is not enabled")
+	}
+
+	var input struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	v.Check(input.Code != "", "code", "must be provided")
+	v.Check(input.State != "", "state", "must be provided")
+
+	if !v.Valid() {
+		return erro.NewValidationErr("oidc validation", v.Errors)
+	}
+
+	nonce, verifier, err := h.Models.OIDC.TakeAuthorization(input.State)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.Unauthorized.WithMessage("invalid or expired sign in state")
+		default:
+			return erro.ThrowInternalServer("take oidc authorization", err)
+		}
+	}
+
+	claims, err := h.Config.Auth.OIDC.Exchange(r.Context(), input.Code, verifier, nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrCodeRejected), errors.Is(err, auth.ErrInvalidIDToken):
+			return erro.Throw(erro.Unauthorized.WithMessage("the identity provider did not confirm the sign in"), erro.Cause("exchange oidc code", err))
+		default:
+			return erro.ThrowInternalServer("exchange oidc code", err)
+		}
+	}
+
+	user, err := h.oidcUser(claims)
+	if err != nil {
+		return err
+	}
+
+	if user.TwoFactorEnabled {
+		return h.writeTwoFactorChallenge(w, user)
+	}
+
+	return h.writeSession(w, r, user)
+}
+
+// oidcUser returns the user signing in with the claims. On the first sign in of an
+// identity, it is linked to the user with the same verified address, who is created when
+// there is none.
+func (h *Handler) oidcUser(claims *auth.IDClaims) (*data.User, error) {
+	issuer := h.Config.Auth.OIDC.Issuer
+
+	user, err := h.Models.OIDC.GetUserForIdentity(issuer, claims.Subject)
+	switch {
+	case err == nil:
+		return user, nil
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, erro.ThrowInternalServer("get user for identity", err)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, erro.Forbidden.WithMessage("the identity provider did not share a verified email address")
+	}
+
+	user, err = h.Models.Users.GetByEmail(claims.Email)
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		if user, err = h.provisionOIDCUser(claims); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, erro.ThrowInternalServer("get user by email", err)
+	case user.ServiceAccount:
+		return nil, erro.Forbidden.WithMessage("service accounts cannot sign in with single sign-on")
+	case !user.Activated:
+		// Anyone could have registered the address, so the password they chose is dropped
+		// now that its owner proved who they are.
+		if err = h.activateOIDCUser(user); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = h.Models.OIDC.LinkIdentity(user.ID, issuer, claims.Subject); err != nil {
+		return nil, erro.ThrowInternalServer("link identity", err)
+	}
+
+	return user, nil
+}
+
+func (h *Handler) provisionOIDCUser(claims *auth.IDClaims) (*data.User, error) {
+	name := claims.Name
+	if name == "" || len(name) > 500 {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := &data.User{
+		Name:      name,
+		Email:     data.Email(claims.Email),
+		Activated: true,
+	}
+
+	if err := user.Password.SetRandom(); err != nil {
+		return nil, erro.ThrowInternalServer("setting password", err)
+	}
+
+	v := validator.New()
+
+	if user.Validate(v); !v.Valid() {
+		return nil, erro.NewValidationErr("user validation", v.Errors)
+	}
+
+	if err := h.createUser(user); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			return nil, erro.Conflict.WithMessage("the account was created by another request, please try again")
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (h *Handler) activateOIDCUser(user *data.User) error {
+	user.Activated = true
+
+	if err := user.Password.SetRandom(); err != nil {
+		return erro.ThrowInternalServer("setting password", err)
+	}
+
+	if err := h.Models.Users.Update(user); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Conflict.WithMessage("error while updating user due to a conflict, please try again")
+		default:
+			return erro.ThrowInternalServer("update user", err)
+		}
+	}
+
+	if err := h.Models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	if err := h.Models.Tokens.DeleteAllSessionsForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	return nil
+}
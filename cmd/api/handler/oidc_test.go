@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/hvpaiva/greenlight/cmd/api/app"
+	"github.com/hvpaiva/greenlight/internal/auth"
+	"github.com/hvpaiva/greenlight/internal/auth/oidctest"
+	"github.com/hvpaiva/greenlight/internal/data"
+)
+
+// These tests run the single sign-on endpoints against a fake identity provider and the
+// database at GREENLIGHT_TEST_DB_DSN, which must have every migration applied. They are
+// skipped when it is not set.
+
+type oidcTest struct {
+	handler *Handler
+	server  *httptest.Server
+	idp     *oidctest.Provider
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+
+	dsn := os.Getenv("GREENLIGHT_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GREENLIGHT_TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	idp := oidctest.New("greenlight", "s3cret")
+	t.Cleanup(idp.Close)
+
+	a := app.New(slog.New(slog.NewTextHandler(io.Discard, nil)), "test", "test", nil)
+	t.Cleanup(a.Shutdown)
+
+	h := New(a, db, nil, Config{
+		Auth: Auth{
+			AccessTTL:  time.Minute,
+			RefreshTTL: time.Hour,
+			OIDC: &auth.OIDC{
+				Issuer:       idp.Issuer(),
+				ClientID:     idp.ClientID,
+				ClientSecret: idp.ClientSecret,
+				RedirectURL:  "https://greenlight.test/sso/callback",
+				Scopes:       []string{"openid", "email", "profile"},
+				KeysTTL:      time.Hour,
+			},
+			OIDCStateTTL: time.Minute,
+		},
+	})
+
+	server := httptest.NewServer(h.Router())
+	t.Cleanup(server.Close)
+
+	return &oidcTest{handler: h, server: server, idp: idp}
+}
+
+// start begins a sign in through the API and plays it at the provider with the claims,
+// returning the code and state the provider redirects back with.
+func (o *oidcTest) start(t *testing.T, claims map[string]any) (code, state string) {
+	t.Helper()
+
+	res, body := o.post(t, "/v1/tokens/oidc/authorization", nil)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("start sign in: status %d: %s", res.StatusCode, body)
+	}
+
+	var output struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+
+	if err := json.Unmarshal(body, &output); err != nil {
+		t.Fatalf("decode authorization: %v", err)
+	}
+
+	code, state, err := o.idp.SignIn(output.AuthorizationURL, claims)
+	if err != nil {
+		t.Fatalf("sign in at provider: %v", err)
+	}
+
+	return code, state
+}
+
+// finish completes a sign in through the API, returning the response status.
+func (o *oidcTest) finish(t *testing.T, code, state string) int {
+	t.Helper()
+
+	res, _ := o.post(t, "/v1/tokens/oidc", map[string]string{"code": code, "state": state})
+
+	return res.StatusCode
+}
+
+func (o *oidcTest) post(t *testing.T, path string, input any) (*http.Response, []byte) {
+	t.Helper()
+
+	payload, err := json.Marshal(input)
+	if err != nil {
+		t.Fatalf("encode request: %v", err)
+	}
+
+	if input == nil {
+		payload = []byte("{}")
+	}
+
+	res, err := http.Post(o.server.URL+path, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("post %s: %v", path, err)
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+
+	return res, body
+}
+
+func (o *oidcTest) deleteUserOnCleanup(t *testing.T, email string) {
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		_, _ = o.handler.Models.Users.DB.ExecContext(ctx, `DELETE FROM users WHERE email = $1`, email)
+	})
+}
+
+func randomHex(t *testing.T) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func TestOIDCProvisionsUser(t *testing.T) {
+	o := newOIDCTest(t)
+
+	email := "sso-" + randomHex(t) + "@example.com"
+	o.deleteUserOnCleanup(t, email)
+
+	code, state := o.start(t, map[string]any{"email": email, "email_verified": true, "name": "Ada"})
+
+	if status := o.finish(t, code, state); status != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", status, http.StatusCreated)
+	}
+
+	user, err := o.handler.Models.Users.GetByEmail(email)
+	if err != nil {
+		t.Fatalf("get provisioned user: %v", err)
+	}
+
+	if !user.Activated || user.Name != "Ada" {
+		t.Errorf("unexpected provisioned user: %+v", user)
+	}
+}
+
+func TestOIDCStateIsSingleUse(t *testing.T) {
+	o := newOIDCTest(t)
+
+	email := "sso-" + randomHex(t) + "@example.com"
+	o.deleteUserOnCleanup(t, email)
+
+	claims := map[string]any{"email": email, "email_verified": true}
+
+	code, state := o.start(t, claims)
+
+	if status := o.finish(t, code, state); status != http.StatusCreated {
+		t.Fatalf("first use: status = %d, want %d", status, http.StatusCreated)
+	}
+
+	// A fresh code does not make a used state valid again.
+	code, _ = o.start(t, claims)
+
+	if status := o.finish(t, code, state); status != http.StatusUnauthorized {
+		t.Errorf("second use: status = %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCLinksOnlyVerifiedEmail(t *testing.T) {
+	o := newOIDCTest(t)
+
+	email := "sso-" + randomHex(t) + "@example.com"
+	o.deleteUserOnCleanup(t, email)
+
+	existing := &data.User{Name: "Existing", Email: data.Email(email), Activated: true}
+	if err := existing.Password.Set("pa55word-" + randomHex(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.handler.Models.Users.Insert(existing); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	subject := "subject-" + randomHex(t)
+
+	code, state := o.start(t, map[string]any{"sub": subject, "email": email, "email_verified": false})
+
+	if status := o.finish(t, code, state); status != http.StatusForbidden {
+		t.Fatalf("unverified email: status = %d, want %d", status, http.StatusForbidden)
+	}
+
+	if _, err := o.handler.Models.OIDC.GetUserForIdentity(o.idp.Issuer(), subject); !errors.Is(err, data.ErrRecordNotFound) {
+		t.Fatalf("identity linked with an unverified email: err = %v", err)
+	}
+
+	code, state = o.start(t, map[string]any{"sub": subject, "email": email, "email_verified": true})
+
+	if status := o.finish(t, code, state); status != http.StatusCreated {
+		t.Fatalf("verified email: status = %d, want %d", status, http.StatusCreated)
+	}
+
+	linked, err := o.handler.Models.OIDC.GetUserForIdentity(o.idp.Issuer(), subject)
+	if err != nil {
+		t.Fatalf("get user for identity: %v", err)
+	}
+
+	if linked.ID != existing.ID {
+		t.Errorf("identity linked to user %d, want %d", linked.ID, existing.ID)
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/internal/policy"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) showPermissionsHandler(w http.ResponseWriter, r *http.Request) error {
+	permissions, err := h.Models.Permission.GetAll()
+	if err != nil {
+		return erro.ThrowInternalServer("get permissions", err)
+	}
+
+	var output struct {
+		Permissions data.Permissions `json:"permissions"`
+	}
+	output.Permissions = permissions
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) showUserPermissionsHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := h.Models.Permission.GetAllForUser(user.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("get user permissions", err)
+	}
+
+	changes, err := h.Models.Permission.GetChangesForUser(user.ID, 50)
+	if err != nil {
+		return erro.ThrowInternalServer("get user permission changes", err)
+	}
+
+	var output struct {
+		Permissions data.Permissions         `json:"permissions"`
+		Changes     []*data.PermissionChange `json:"changes"`
+	}
+	output.Permissions = permissions
+	output.Changes = changes
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	if err = ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Permissions) > 0, "permissions", "must contain at least one permission")
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+
+	if !v.Valid() {
+		return erro.NewValidationErr("permission validation", v.Errors)
+	}
+
+	if err = h.checkPermissionCodes(v, input.Permissions); err != nil {
+		return err
+	}
+
+	granted, err := h.Models.Permission.GrantForUser(h.App.ContextGetUser(r).ID, user.ID, input.Permissions...)
+	if err != nil {
+		return erro.ThrowInternalServer("grant permissions", err)
+	}
+
+	h.Middleware.InvalidatePermissions(user.ID)
+
+	permissions, err := h.Models.Permission.GetAllForUser(user.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("get user permissions", err)
+	}
+
+	var output struct {
+		Granted     data.Permissions `json:"granted"`
+		Permissions data.Permissions `json:"permissions"`
+	}
+	output.Granted = granted
+	output.Permissions = permissions
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	if err = h.checkPermissionCodes(validator.New(), []string{code}); err != nil {
+		return err
+	}
+
+	actor := h.App.ContextGetUser(r)
+
+	if user.ID == actor.ID && code == data.PermissionUsersAdmin {
+		return erro.Forbidden.WithMessage("you cannot revoke your own admin permission")
+	}
+
+	revoked, err := h.Models.Permission.RemoveForUser(actor.ID, user.ID, code)
+	if err != nil {
+		return erro.ThrowInternalServer("revoke permission", err)
+	}
+
+	h.Middleware.InvalidatePermissions(user.ID)
+
+	if len(revoked) == 0 {
+		return erro.NotFound.WithMessage("the user was not granted this permission directly")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// authorizeRecord applies the rule to a record loaded by the handler, after the route
+// middlewares have already checked the user holds some of the permissions it accepts.
+func (h *Handler) authorizeRecord(r *http.Request, rule policy.Rule, record policy.Owned) error {
+	permissions, err := h.Middleware.Permissions(r)
+	if err != nil {
+		return erro.ThrowInternalServer("get user permissions", err)
+	}
+
+	if !rule.Allows(h.App.ContextGetUser(r).ID, permissions, record) {
+		return erro.Forbidden.WithMessage("you do not have permission to modify this record")
+	}
+
+	return nil
+}
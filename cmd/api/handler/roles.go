@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) showRolesHandler(w http.ResponseWriter, r *http.Request) error {
+	roles, err := h.Models.Roles.GetAll()
+	if err != nil {
+		return erro.ThrowInternalServer("get roles", err)
+	}
+
+	var output struct {
+		Roles []*data.Role `json:"roles"`
+	}
+	output.Roles = roles
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) createRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	role := &data.Role{
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+	}
+
+	if role.Permissions == nil {
+		role.Permissions = data.Permissions{}
+	}
+
+	v := validator.New()
+
+	if role.Validate(v); !v.Valid() {
+		return erro.NewValidationErr("role validation", v.Errors)
+	}
+
+	if err := h.checkPermissionCodes(v, role.Permissions); err != nil {
+		return err
+	}
+
+	if err := h.Models.Roles.Insert(role); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRoleName):
+			v.AddError("name", "a role with this name already exists")
+			return erro.NewValidationErr("role insert", v.Errors)
+		default:
+			return erro.ThrowInternalServer("role insert", err)
+		}
+	}
+
+	var output struct {
+		Role *data.Role `json:"role"`
+	}
+	output.Role = role
+
+	if err := ujson.Write(w, http.StatusCreated, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) updateRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	role, err := h.roleFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Description *string  `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err = ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	if input.Description != nil {
+		role.Description = *input.Description
+	}
+
+	if input.Permissions != nil {
+		role.Permissions = input.Permissions
+	}
+
+	v := validator.New()
+
+	if role.Validate(v); !v.Valid() {
+		return erro.NewValidationErr("role validation", v.Errors)
+	}
+
+	if err = h.checkPermissionCodes(v, role.Permissions); err != nil {
+		return err
+	}
+
+	if err = h.Models.Roles.Update(h.App.ContextGetUser(r).ID, role); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the role you are looking for does not exist")
+		case errors.Is(err, data.ErrAdminLockout):
+			return erro.Forbidden.WithMessage("you cannot remove your own admin permission")
+		default:
+			return erro.ThrowInternalServer("role update", err)
+		}
+	}
+
+	h.Middleware.InvalidatePermissions()
+
+	var output struct {
+		Role *data.Role `json:"role"`
+	}
+	output.Role = role
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) deleteRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	if name == h.Config.DefaultRole {
+		return erro.Conflict.WithMessage("the default role for new users cannot be deleted")
+	}
+
+	if err := h.Models.Roles.Delete(h.App.ContextGetUser(r).ID, name); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the role you are looking for does not exist")
+		case errors.Is(err, data.ErrAdminLockout):
+			return erro.Forbidden.WithMessage("you cannot remove your own admin permission")
+		default:
+			return erro.ThrowInternalServer("role delete", err)
+		}
+	}
+
+	h.Middleware.InvalidatePermissions()
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// showRoleChangesHandler lists the changes to the permissions of the role, which remain
+// available once the role is deleted.
+func (h *Handler) showRoleChangesHandler(w http.ResponseWriter, r *http.Request) error {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	changes, err := h.Models.Permission.GetChangesForRole(name, 50)
+	if err != nil {
+		return erro.ThrowInternalServer("get role permission changes", err)
+	}
+
+	var output struct {
+		Changes []*data.PermissionChange `json:"changes"`
+	}
+	output.Changes = changes
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) showUserRolesHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	roles, err := h.Models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("get user roles", err)
+	}
+
+	var output struct {
+		Roles []string `json:"roles"`
+	}
+	output.Roles = roles
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) assignUserRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	role, err := h.roleFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err = h.Models.Roles.AssignToUser(h.App.ContextGetUser(r).ID, user.ID, role.Name); err != nil {
+		return erro.ThrowInternalServer("assign role", err)
+	}
+
+	h.Middleware.InvalidatePermissions(user.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) removeUserRoleHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.userFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	name := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	removed, err := h.Models.Roles.RemoveFromUser(h.App.ContextGetUser(r).ID, user.ID, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAdminLockout):
+			return erro.Forbidden.WithMessage("you cannot remove your own admin permission")
+		default:
+			return erro.ThrowInternalServer("remove role", err)
+		}
+	}
+
+	h.Middleware.InvalidatePermissions(user.ID)
+
+	if !removed {
+		return erro.NotFound.WithMessage("the user does not have this role")
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) roleFromParams(r *http.Request) (*data.Role, error) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	role, err := h.Models.Roles.GetByName(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, erro.NotFound.WithMessage("the role you are looking for does not exist")
+		default:
+			return nil, erro.ThrowInternalServer("get role", err)
+		}
+	}
+
+	return role, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/hvpaiva/greenlight/cmd/api/erro"
 	"github.com/hvpaiva/greenlight/cmd/api/middleware"
 	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/internal/policy"
 	"github.com/hvpaiva/greenlight/pkg/uslices"
 )
 
@@ -19,15 +20,74 @@ func (h *Handler) Router() http.Handler {
 
 	h.register(r, http.MethodGet, "/v1/movies", h.showMoviesHandler, h.Middleware.Authorize(data.PermissionMovieRead))
 	h.register(r, http.MethodGet, "/v1/movies/:id", h.getMovieHandler, h.Middleware.Authorize(data.PermissionMovieRead))
-	h.register(r, http.MethodPost, "/v1/movies", h.createMovieHandler, h.Middleware.Authorize(data.PermissionMovieWrite))
-	h.register(r, http.MethodPut, "/v1/movies/:id", h.updateMovieHandler, h.Middleware.Authorize(data.PermissionMovieWrite))
-	h.register(r, http.MethodDelete, "/v1/movies/:id", h.deleteMovieHandler, h.Middleware.Authorize(data.PermissionMovieWrite))
-	h.register(r, http.MethodPatch, "/v1/movies/:id", h.patchMovieHandler, h.Middleware.Authorize(data.PermissionMovieWrite))
+	h.register(r, http.MethodGet, "/v1/movies/:id/similar", h.similarMoviesHandler, h.Middleware.Authorize(data.PermissionMovieRead))
+	h.register(r, http.MethodPost, "/v1/movies", h.createMovieHandler, h.Middleware.Authorize(policy.MovieWrite.Permissions()...), h.Middleware.Idempotent)
+	h.register(r, http.MethodPut, "/v1/movies/:id", h.updateMovieHandler, h.Middleware.Authorize(policy.MovieWrite.Permissions()...))
+	h.register(r, http.MethodDelete, "/v1/movies/:id", h.deleteMovieHandler, h.Middleware.Authorize(policy.MovieWrite.Permissions()...))
+	h.register(r, http.MethodPatch, "/v1/movies/:id", h.patchMovieHandler, h.Middleware.Authorize(policy.MovieWrite.Permissions()...))
 
-	h.register(r, http.MethodPost, "/v1/users", h.registerUserHandler)
+	h.register(r, http.MethodGet, "/v1/movies/:id/tags", h.showMovieTagsHandler, h.Middleware.Authorize(data.PermissionMovieRead))
+	h.register(r, http.MethodPost, "/v1/movies/:id/tags", h.addMovieTagHandler, h.Middleware.Authorize(data.PermissionMovieRead))
+	h.register(r, http.MethodDelete, "/v1/movies/:id/tags/:tag", h.removeMovieTagHandler, h.Middleware.Authorize(data.PermissionMovieRead))
+	h.register(r, http.MethodPut, "/v1/movies/:id/tags/:tag/vote", h.voteMovieTagHandler, h.Middleware.Authorize(data.PermissionMovieRead))
+
+	h.register(r, http.MethodGet, "/v1/tags", h.searchTagsHandler, h.Middleware.Authorize(data.PermissionMovieRead))
+	h.register(r, http.MethodPut, "/v1/tags/:tag/ban", h.banTagHandler, h.Middleware.Authorize(data.PermissionTagModerate))
+	h.register(r, http.MethodDelete, "/v1/tags/:tag/ban", h.unbanTagHandler, h.Middleware.Authorize(data.PermissionTagModerate))
+
+	h.register(r, http.MethodGet, "/v1/stats/movies", h.movieStatsHandler, h.Middleware.Authorize(data.PermissionStatsRead))
+
+	h.register(r, http.MethodPost, "/v1/users", h.registerUserHandler, h.Middleware.Idempotent)
 	h.register(r, http.MethodPatch, "/v1/users/activated", h.activateUserHandler)
+	h.register(r, http.MethodPut, "/v1/users/password", h.updateUserPasswordHandler)
+	h.register(r, http.MethodPut, "/v1/users/email", h.confirmEmailChangeHandler)
+	h.register(r, http.MethodPost, "/v1/users/me/email", h.requestEmailChangeHandler, h.Middleware.RequireActivated)
+	h.register(r, http.MethodGet, "/v1/users/me", h.showCurrentUserHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodPatch, "/v1/users/me", h.updateCurrentUserHandler, h.Middleware.RequireActivated)
+	h.register(r, http.MethodDelete, "/v1/users/me", h.deleteCurrentUserHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodDelete, "/v1/users/me/deletion", h.cancelCurrentUserDeletionHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodGet, "/v1/users/me/export", h.exportCurrentUserHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodPut, "/v1/users/me/password", h.changeCurrentUserPasswordHandler, h.Middleware.RequireActivated)
+	h.register(r, http.MethodGet, "/v1/users/me/sessions", h.showSessionsHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodDelete, "/v1/users/me/sessions/:id", h.deleteSessionHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodPost, "/v1/users/me/2fa", h.enrolTwoFactorHandler, h.Middleware.RequireActivated)
+	h.register(r, http.MethodPost, "/v1/users/me/2fa/confirm", h.confirmTwoFactorHandler, h.Middleware.RequireActivated)
+	h.register(r, http.MethodDelete, "/v1/users/me/2fa", h.disableTwoFactorHandler, h.Middleware.RequireActivated)
 
 	h.register(r, http.MethodPost, "/v1/tokens/authentication", h.creteAuthTokenHandler)
+	h.register(r, http.MethodPost, "/v1/tokens/authentication/2fa", h.createTwoFactorAuthTokenHandler)
+	h.register(r, http.MethodPost, "/v1/tokens/oidc/authorization", h.createOIDCAuthorizationHandler)
+	h.register(r, http.MethodPost, "/v1/tokens/oidc", h.createOIDCAuthTokenHandler)
+	h.register(r, http.MethodPost, "/v1/tokens/refresh", h.refreshAuthTokenHandler)
+	h.register(r, http.MethodDelete, "/v1/tokens/authentication", h.deleteAuthTokenHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodDelete, "/v1/tokens/authentication/all", h.deleteAllAuthTokensHandler, h.Middleware.RequireAuthenticated)
+	h.register(r, http.MethodPost, "/v1/tokens/password-reset", h.createPasswordResetTokenHandler)
+	h.register(r, http.MethodPost, "/v1/tokens/activation", h.createActivationTokenHandler)
+
+	h.register(r, http.MethodGet, "/v1/admin/users", h.adminShowUsersHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/users/:id", h.adminGetUserHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPatch, "/v1/admin/users/:id", h.adminUpdateUserHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPost, "/v1/admin/users/:id/password-reset", h.adminResetUserPasswordHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/users/:id/permissions", h.showUserPermissionsHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPost, "/v1/admin/users/:id/permissions", h.grantUserPermissionsHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodDelete, "/v1/admin/users/:id/permissions/:code", h.revokeUserPermissionHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/users/:id/roles", h.showUserRolesHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPut, "/v1/admin/users/:id/roles/:role", h.assignUserRoleHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodDelete, "/v1/admin/users/:id/roles/:role", h.removeUserRoleHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/roles", h.showRolesHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPost, "/v1/admin/roles", h.createRoleHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPatch, "/v1/admin/roles/:role", h.updateRoleHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodDelete, "/v1/admin/roles/:role", h.deleteRoleHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/roles/:role/changes", h.showRoleChangesHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/permissions", h.showPermissionsHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodDelete, "/v1/admin/users/:id/tokens", h.adminDeleteUserTokensHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/lockouts", h.showLockoutsHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodDelete, "/v1/admin/users/:id/lockout", h.unlockUserHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPut, "/v1/admin/2fa/required", h.adminRequireTwoFactorHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPost, "/v1/admin/service-accounts", h.createServiceAccountHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodGet, "/v1/admin/users/:id/api-keys", h.showAPIKeysHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodPost, "/v1/admin/users/:id/api-keys", h.createAPIKeyHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
+	h.register(r, http.MethodDelete, "/v1/admin/users/:id/api-keys/:key_id", h.deleteAPIKeyHandler, h.Middleware.Authorize(data.PermissionUsersAdmin))
 
 	r.Handler(http.MethodGet, "/v1/debug/vars", expvar.Handler())
 
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/jwt"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+)
+
+func (h *Handler) showSessionsHandler(w http.ResponseWriter, r *http.Request) error {
+	user := h.App.ContextGetUser(r)
+	token := h.App.ContextGetToken(r)
+
+	sessions, err := h.Models.Tokens.GetSessionsForUser(user.ID, data.TokenHash(token))
+	if err != nil {
+		return erro.ThrowInternalServer("get user sessions", err)
+	}
+
+	var output struct {
+		Sessions []*data.Session `json:"sessions"`
+	}
+	output.Sessions = sessions
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) deleteSessionHandler(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseId(r)
+	if err != nil {
+		return erro.Throw(erro.BadRequest.WithMessage("invalid id"), erro.Cause("parsing id", err))
+	}
+
+	user := h.App.ContextGetUser(r)
+
+	if err = h.Models.Tokens.DeleteSession(user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the session you are looking for does not exist")
+		default:
+			return erro.ThrowInternalServer("delete session", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// currentFamily returns the refresh token family of the session the request was made with,
+// or nil when it was not made with a session token, as with api keys.
+func (h *Handler) currentFamily(r *http.Request) ([]byte, error) {
+	token := h.App.ContextGetToken(r)
+
+	if h.Config.Auth.JWT != nil && jwt.IsJWT(token) {
+		claims, err := h.Config.Auth.JWT.Verify(token)
+		if err != nil {
+			return nil, erro.Unauthorized.WithMessage("invalid or expired authorization token")
+		}
+
+		family, err := claims.Family()
+		if err != nil {
+			return nil, erro.Unauthorized.WithMessage("invalid or malformed authorization token")
+		}
+
+		return family, nil
+	}
+
+	family, err := h.Models.Tokens.GetFamily(data.TokenHash(token))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, nil
+		default:
+			return nil, erro.ThrowInternalServer("get token family", err)
+		}
+	}
+
+	return family, nil
+}
+
+func userAgent(r *http.Request) string {
+	ua := strings.ToValidUTF8(r.UserAgent(), "")
+
+	if len(ua) > 512 {
+		return strings.ToValidUTF8(ua[:512], "")
+	}
+
+	return ua
+}
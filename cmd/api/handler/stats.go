@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/pkg/query"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) movieStatsHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Title  string
+		Genres []string
+		From   time.Time
+		To     time.Time
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	input.Title = query.ReadString(qs, "title", "")
+	input.Genres = query.ReadCSV(qs, "genres", []string{})
+	input.From = query.ReadDate(qs, "from", today.AddDate(0, 0, -30), v)
+	input.To = query.ReadDate(qs, "to", today, v)
+
+	v.Check(!input.From.After(input.To), "from", "must not be after to")
+	v.Check(input.To.Sub(input.From) <= 366*24*time.Hour, "to", "must not be more than 366 days after from")
+
+	if !v.Valid() {
+		return erro.NewValidationErr("stats filter validation", v.Errors)
+	}
+
+	// The title and genres are quoted, so no two filters share a key whatever they contain.
+	key := fmt.Sprintf("%q %q %s %s",
+		input.Title,
+		input.Genres,
+		input.From.Format(time.DateOnly),
+		input.To.Format(time.DateOnly),
+	)
+
+	stats, ok := h.statsCache.Get(key)
+	if !ok {
+		var err error
+
+		stats, err = h.Models.Stats.GetMovieStats(input.Title, input.Genres, input.From, input.To)
+		if err != nil {
+			return erro.ThrowInternalServer("get movie stats", err)
+		}
+
+		h.statsCache.Set(key, stats)
+	}
+
+	if err := ujson.Write(w, http.StatusOK, stats, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/query"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) showMovieTagsHandler(w http.ResponseWriter, r *http.Request) error {
+	movie, err := h.movieFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	tags, err := h.Models.Tags.GetAllForMovie(int64(movie.ID))
+	if err != nil {
+		return erro.ThrowInternalServer("get movie tags", err)
+	}
+
+	var output struct {
+		Tags []*data.MovieTag `json:"tags"`
+	}
+	output.Tags = tags
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) addMovieTagHandler(w http.ResponseWriter, r *http.Request) error {
+	movie, err := h.movieFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Tag string `json:"tag"`
+	}
+
+	if err = ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	input.Tag = data.NormalizeTag(input.Tag)
+
+	v := validator.New()
+
+	if data.ValidateTag(v, input.Tag); !v.Valid() {
+		return erro.NewValidationErr("tag validation", v.Errors)
+	}
+
+	tag, err := h.Models.Tags.Upsert(input.Tag)
+	if err != nil {
+		return erro.ThrowInternalServer("upsert tag", err)
+	}
+
+	if tag.Banned {
+		v.AddError("tag", "this tag has been banned by a moderator")
+		return erro.NewValidationErr("tag validation", v.Errors)
+	}
+
+	user := h.App.ContextGetUser(r)
+
+	if err = h.Models.Tags.Vote(int64(movie.ID), tag.ID, user.ID, 1); err != nil {
+		return erro.ThrowInternalServer("vote tag", err)
+	}
+
+	return h.writeMovieTags(w, http.StatusCreated, int64(movie.ID))
+}
+
+func (h *Handler) removeMovieTagHandler(w http.ResponseWriter, r *http.Request) error {
+	movie, err := h.movieFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	tag, err := h.tagFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	user := h.App.ContextGetUser(r)
+
+	if err = h.Models.Tags.RemoveVote(int64(movie.ID), tag.ID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("you have not tagged this movie with this tag")
+		default:
+			return erro.ThrowInternalServer("remove tag vote", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) voteMovieTagHandler(w http.ResponseWriter, r *http.Request) error {
+	movie, err := h.movieFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	tag, err := h.tagFromParams(r)
+	if err != nil {
+		return err
+	}
+
+	var input struct {
+		Vote int `json:"vote"`
+	}
+
+	if err = ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if v.Check(validator.Permitted(input.Vote, 1, -1), "vote", "must be 1 or -1"); !v.Valid() {
+		return erro.NewValidationErr("vote validation", v.Errors)
+	}
+
+	onMovie, err := h.Models.Tags.IsOnMovie(int64(movie.ID), tag.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("check movie tag", err)
+	}
+
+	if !onMovie {
+		return erro.NotFound.WithMessage("the movie has not been tagged with this tag")
+	}
+
+	user := h.App.ContextGetUser(r)
+
+	if err = h.Models.Tags.Vote(int64(movie.ID), tag.ID, user.ID, input.Vote); err != nil {
+		return erro.ThrowInternalServer("vote tag", err)
+	}
+
+	return h.writeMovieTags(w, http.StatusOK, int64(movie.ID))
+}
+
+func (h *Handler) searchTagsHandler(w http.ResponseWriter, r *http.Request) error {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	prefix := data.NormalizeTag(query.ReadString(qs, "q", ""))
+	limit := query.ReadInt(qs, "limit", 10, v)
+
+	v.Check(prefix != "", "q", "must be provided")
+	v.Check(len(prefix) <= 50, "q", "must not be more than 50 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 50, "limit", "must be a maximum of 50")
+
+	if !v.Valid() {
+		return erro.NewValidationErr("tag search validation", v.Errors)
+	}
+
+	tags, err := h.Models.Tags.Search(prefix, limit)
+	if err != nil {
+		return erro.ThrowInternalServer("search tags", err)
+	}
+
+	var output struct {
+		Tags []*data.TagSuggestion `json:"tags"`
+	}
+	output.Tags = tags
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) banTagHandler(w http.ResponseWriter, r *http.Request) error {
+	return h.setTagBanned(w, r, true)
+}
+
+func (h *Handler) unbanTagHandler(w http.ResponseWriter, r *http.Request) error {
+	return h.setTagBanned(w, r, false)
+}
+
+func (h *Handler) setTagBanned(w http.ResponseWriter, r *http.Request, banned bool) error {
+	name, err := parseTag(r)
+	if err != nil {
+		return err
+	}
+
+	tag, err := h.Models.Tags.SetBanned(name, banned)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.NotFound.WithMessage("the tag you are looking for does not exist")
+		default:
+			return erro.ThrowInternalServer("set tag banned", err)
+		}
+	}
+
+	if err = ujson.Write(w, http.StatusOK, tag, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) writeMovieTags(w http.ResponseWriter, status int, movieID int64) error {
+	tags, err := h.Models.Tags.GetAllForMovie(movieID)
+	if err != nil {
+		return erro.ThrowInternalServer("get movie tags", err)
+	}
+
+	var output struct {
+		Tags []*data.MovieTag `json:"tags"`
+	}
+	output.Tags = tags
+
+	if err = ujson.Write(w, status, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) movieFromParams(r *http.Request) (*data.Movie, error) {
+	id, err := parseId(r)
+	if err != nil {
+		return nil, erro.Throw(erro.BadRequest.WithMessage("invalid id"), erro.Cause("parsing id", err))
+	}
+
+	movie, err := h.Models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, erro.NotFound.WithMessage("the movie you are looking for does not exist")
+		default:
+			return nil, erro.ThrowInternalServer("get movie", err)
+		}
+	}
+
+	return movie, nil
+}
+
+func (h *Handler) tagFromParams(r *http.Request) (*data.Tag, error) {
+	name, err := parseTag(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := h.Models.Tags.GetByName(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, erro.NotFound.WithMessage("the tag you are looking for does not exist")
+		default:
+			return nil, erro.ThrowInternalServer("get tag", err)
+		}
+	}
+
+	if tag.Banned {
+		return nil, erro.NotFound.WithMessage("the tag you are looking for does not exist")
+	}
+
+	return tag, nil
+}
+
+func parseTag(r *http.Request) (string, error) {
+	name := data.NormalizeTag(httprouter.ParamsFromContext(r.Context()).ByName("tag"))
+
+	v := validator.New()
+
+	if data.ValidateTag(v, name); !v.Valid() {
+		return "", erro.NewValidationErr("tag validation", v.Errors)
+	}
+
+	return name, nil
+}
@@ -3,10 +3,14 @@ package handler
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/tomasen/realip"
+
 	"github.com/hvpaiva/greenlight/cmd/api/erro"
 	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/jwt"
 	"github.com/hvpaiva/greenlight/pkg/ujson"
 	"github.com/hvpaiva/greenlight/pkg/validator"
 )
@@ -30,39 +34,278 @@ func (h *Handler) creteAuthTokenHandler(w http.ResponseWriter, r *http.Request)
 		return erro.NewValidationErr("auth validation", v.Errors)
 	}
 
+	ip := realip.FromRequest(r)
+
+	if err := h.checkLoginThrottle(w, input.Email, ip); err != nil {
+		return err
+	}
+
 	user, err := h.Models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			h.recordLoginFailure(input.Email, ip)
 			return erro.Throw(erro.Unauthorized, erro.Cause("get user by email", err))
 		default:
 			return erro.ThrowInternalServer("get user by email", err)
 		}
 	}
 
+	if user.ServiceAccount {
+		return erro.Throw(erro.Unauthorized, erro.Cause("invalid credential", errors.New("service accounts authenticate with api keys")))
+	}
+
 	match, err := user.Password.Matches(input.Password)
 	if err != nil {
 		return erro.ThrowInternalServer("matching password", err)
 	}
 
 	if !match {
+		h.recordLoginFailure(input.Email, ip)
 		return erro.Throw(erro.Unauthorized, erro.Cause("invalid credential", err))
 	}
 
-	token, err := h.Models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// The failures of an account with two-factor authentication are only reset once the
+	// second factor is checked, so guessing codes counts towards the same lockout.
+	if user.TwoFactorEnabled {
+		return h.writeTwoFactorChallenge(w, user)
+	}
+
+	h.resetLoginFailures(input.Email)
+
+	return h.writeSession(w, r, user)
+}
+
+// writeSession starts a new session for the user and responds with its token pair.
+func (h *Handler) writeSession(w http.ResponseWriter, r *http.Request, user *data.User) error {
+	if user.Suspended {
+		return erro.Forbidden.WithMessage("your account has been suspended")
+	}
+
+	pair, err := h.Models.Tokens.NewSession(user.ID, h.statefulAccessTTL(), h.Config.Auth.RefreshTTL, realip.FromRequest(r), userAgent(r))
 	if err != nil {
 		return erro.ThrowInternalServer("create token", err)
 	}
 
+	if err = h.signAccessToken(pair, user); err != nil {
+		return erro.ThrowInternalServer("sign access token", err)
+	}
+
+	if err = ujson.Write(w, http.StatusCreated, pair, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		return erro.NewValidationErr("email validation", v.Errors)
+	}
+
+	var output struct {
+		Message string `json:"message"`
+	}
+	output.Message = "if an activated account exists for that email address, a password reset token will be sent to it"
+
+	user, err := h.Models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return erro.ThrowInternalServer("get user by email", err)
+	}
+
+	if user != nil && user.Activated && !user.ServiceAccount {
+		token, err := h.Models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			return erro.ThrowInternalServer("create token", err)
+		}
+
+		h.sendMail(string(user.Email), "password_reset.tmpl", map[string]any{
+			"passwordResetToken": token.Plaintext,
+		})
+	}
+
+	if err = ujson.Write(w, http.StatusAccepted, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		return erro.NewValidationErr("email validation", v.Errors)
+	}
+
+	if !h.activationLimiter.Allow(strings.ToLower(input.Email)) {
+		return erro.TooManyRequests.WithMessage("too many activation requests for this email address, please try again later")
+	}
+
 	var output struct {
-		AccessToken *data.Token `json:"access_token"`
+		Message string `json:"message"`
+	}
+	output.Message = "if a non-activated account exists for that email address, a new activation token will be sent to it"
+
+	user, err := h.Models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return erro.ThrowInternalServer("get user by email", err)
+	}
+
+	if user != nil && !user.Activated {
+		if err = h.Models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID); err != nil {
+			return erro.ThrowInternalServer("delete user tokens", err)
+		}
+
+		token, err := h.Models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return erro.ThrowInternalServer("create token", err)
+		}
+
+		h.sendMail(string(user.Email), "token_activation.tmpl", map[string]any{
+			"activationToken": token.Plaintext,
+		})
+	}
+
+	if err = ujson.Write(w, http.StatusAccepted, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) deleteAuthTokenHandler(w http.ResponseWriter, r *http.Request) error {
+	token := h.App.ContextGetToken(r)
+
+	revoke := func() error { return h.Models.Tokens.DeleteByHash(data.TokenHash(token)) }
+
+	if h.Config.Auth.JWT != nil && jwt.IsJWT(token) {
+		claims, err := h.Config.Auth.JWT.Verify(token)
+		if err != nil {
+			return erro.Unauthorized.WithMessage("invalid or expired authorization token")
+		}
+
+		family, err := claims.Family()
+		if err != nil || len(family) == 0 {
+			return erro.Unauthorized.WithMessage("invalid or malformed authorization token")
+		}
+
+		revoke = func() error { return h.Models.Tokens.DeleteFamily(family) }
+	}
+
+	if err := revoke(); err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.Unauthorized.WithMessage("invalid or expired authorization token")
+		default:
+			return erro.ThrowInternalServer("delete token", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) deleteAllAuthTokensHandler(w http.ResponseWriter, r *http.Request) error {
+	user := h.App.ContextGetUser(r)
+
+	if err := h.Models.Tokens.DeleteAllSessionsForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) refreshAuthTokenHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidateToken(v, input.RefreshToken); !v.Valid() {
+		return erro.NewValidationErr("token validation", v.Errors)
+	}
+
+	pair, err := h.Models.Tokens.Rotate(input.RefreshToken, h.statefulAccessTTL(), h.Config.Auth.RefreshTTL, realip.FromRequest(r), userAgent(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.Unauthorized.WithMessage("invalid or expired refresh token")
+		case errors.Is(err, data.ErrTokenReused):
+			return erro.Throw(erro.Unauthorized.WithMessage("refresh token was already used, the session has been revoked"), erro.Cause("rotate refresh token", err))
+		default:
+			return erro.ThrowInternalServer("rotate refresh token", err)
+		}
 	}
 
-	output.AccessToken = token
+	if h.Config.Auth.JWT != nil {
+		user, err := h.Models.Users.Get(pair.UserID)
+		if err != nil {
+			return erro.ThrowInternalServer("get user", err)
+		}
+
+		if user.Suspended {
+			return erro.Forbidden.WithMessage("your account has been suspended")
+		}
 
-	if err = ujson.Write(w, http.StatusCreated, output, nil); err != nil {
+		if err = h.signAccessToken(pair, user); err != nil {
+			return erro.ThrowInternalServer("sign access token", err)
+		}
+	}
+
+	if err = ujson.Write(w, http.StatusCreated, pair, nil); err != nil {
 		return erro.ThrowInternalServer("output response", err)
 	}
 
 	return nil
 }
+
+// statefulAccessTTL is the lifetime of the access tokens stored in the database, which are
+// not issued at all when access tokens are stateless JWTs.
+func (h *Handler) statefulAccessTTL() time.Duration {
+	if h.Config.Auth.JWT != nil {
+		return 0
+	}
+
+	return h.Config.Auth.AccessTTL
+}
+
+func (h *Handler) signAccessToken(pair *data.TokenPair, user *data.User) error {
+	if h.Config.Auth.JWT == nil {
+		return nil
+	}
+
+	permissions, err := h.Models.Permission.GetAllForUser(user.ID)
+	if err != nil {
+		return err
+	}
+
+	pair.AccessToken, err = h.Config.Auth.JWT.Issue(user, permissions, pair.Family, h.Config.Auth.AccessTTL)
+	return err
+}
@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tomasen/realip"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/internal/policy"
+	"github.com/hvpaiva/greenlight/pkg/totp"
+	"github.com/hvpaiva/greenlight/pkg/ujson"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+func (h *Handler) enrolTwoFactorHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	if user.ServiceAccount {
+		return erro.Forbidden.WithMessage("service accounts cannot enable two-factor authentication")
+	}
+
+	if user.TwoFactorEnabled {
+		return erro.Conflict.WithMessage("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return erro.ThrowInternalServer("generate totp secret", err)
+	}
+
+	if err = h.Models.TwoFactor.SetPending(user.ID, secret); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Conflict.WithMessage("two-factor authentication is already enabled")
+		default:
+			return erro.ThrowInternalServer("set totp secret", err)
+		}
+	}
+
+	var output struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}
+	output.Secret = secret
+	output.URI = totp.URI(h.Config.Auth.TOTPIssuer, string(user.Email), secret)
+
+	if err = ujson.Write(w, http.StatusCreated, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) confirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		return erro.NewValidationErr("code validation", v.Errors)
+	}
+
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	if user.TwoFactorEnabled {
+		return erro.Conflict.WithMessage("two-factor authentication is already enabled")
+	}
+
+	ok, err := h.verifyTOTP(user.ID, input.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.Conflict.WithMessage("two-factor enrolment was not started")
+		default:
+			return err
+		}
+	}
+
+	if !ok {
+		v.AddError("code", "is invalid or expired")
+		return erro.NewValidationErr("code validation", v.Errors)
+	}
+
+	codes, err := data.GenerateRecoveryCodes()
+	if err != nil {
+		return erro.ThrowInternalServer("generate recovery codes", err)
+	}
+
+	if err = h.Models.TwoFactor.Enable(user.ID, codes); err != nil {
+		switch {
+		case errors.Is(err, data.ErrTwoFactorNotPending):
+			return erro.Conflict.WithMessage("two-factor enrolment was not started")
+		default:
+			return erro.ThrowInternalServer("enable two-factor", err)
+		}
+	}
+
+	var output struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	output.RecoveryCodes = codes
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) disableTwoFactorHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return erro.Conflict.WithMessage("two-factor authentication is not enabled")
+	}
+
+	required, err := h.Middleware.TwoFactorRequired(r)
+	if err != nil {
+		return erro.ThrowInternalServer("check two-factor requirement", err)
+	}
+
+	if required {
+		return erro.Forbidden.WithMessage("two-factor authentication is required for this account")
+	}
+
+	if err = h.checkSecondFactor(user.ID, input.Code, input.RecoveryCode); err != nil {
+		return err
+	}
+
+	if err = h.Models.TwoFactor.Disable(user.ID); err != nil {
+		return erro.ThrowInternalServer("disable two-factor", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func (h *Handler) createTwoFactorAuthTokenHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidateToken(v, input.ChallengeToken); !v.Valid() {
+		return erro.NewValidationErr("token validation", v.Errors)
+	}
+
+	user, err := h.Models.Users.GetForToken(data.ScopeTwoFactor, input.ChallengeToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return erro.Unauthorized.WithMessage("invalid or expired challenge token")
+		default:
+			return erro.ThrowInternalServer("get user for token", err)
+		}
+	}
+
+	// Attempts are limited per user rather than per challenge, since anyone knowing the
+	// password can ask for as many challenges as they like.
+	if !h.challengeLimiter.Allow(strconv.FormatInt(user.ID, 10)) {
+		return erro.TooManyRequests.WithMessage("too many two-factor attempts, please try again later")
+	}
+
+	ip := realip.FromRequest(r)
+
+	if err = h.checkLoginThrottle(w, string(user.Email), ip); err != nil {
+		return err
+	}
+
+	if err = h.checkSecondFactor(user.ID, input.Code, input.RecoveryCode); err != nil {
+		var e erro.Error
+		if errors.As(err, &e) && e.Status == http.StatusUnauthorized {
+			h.recordLoginFailure(string(user.Email), ip)
+		}
+
+		return err
+	}
+
+	h.resetLoginFailures(string(user.Email))
+
+	if err = h.Models.Tokens.DeleteAllForUser(data.ScopeTwoFactor, user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	return h.writeSession(w, r, user)
+}
+
+func (h *Handler) adminRequireTwoFactorHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Permissions []string `json:"permissions"`
+		Required    *bool    `json:"required"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	if len(input.Permissions) == 0 {
+		input.Permissions = policy.MovieWrite.Permissions()
+	}
+
+	required := true
+	if input.Required != nil {
+		required = *input.Required
+	}
+
+	v := validator.New()
+
+	if err := h.checkPermissionCodes(v, input.Permissions); err != nil {
+		return err
+	}
+
+	if err := h.Models.TwoFactor.SetRequiredForPermissions(input.Permissions, required); err != nil {
+		return erro.ThrowInternalServer("set two-factor required", err)
+	}
+
+	h.Middleware.InvalidatePermissions()
+
+	permissions, err := h.Models.TwoFactor.GetRequiredPermissions()
+	if err != nil {
+		return erro.ThrowInternalServer("get two-factor permissions", err)
+	}
+
+	var output struct {
+		Permissions data.Permissions `json:"permissions"`
+	}
+	output.Permissions = permissions
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+// writeTwoFactorChallenge responds to a login of a user with two-factor authentication
+// enabled, with the short-lived token that must be exchanged along with a code.
+func (h *Handler) writeTwoFactorChallenge(w http.ResponseWriter, user *data.User) error {
+	if user.Suspended {
+		return erro.Forbidden.WithMessage("your account has been suspended")
+	}
+
+	token, err := h.Models.Tokens.New(user.ID, h.Config.Auth.ChallengeTTL, data.ScopeTwoFactor)
+	if err != nil {
+		return erro.ThrowInternalServer("create token", err)
+	}
+
+	var output struct {
+		TwoFactorRequired bool        `json:"two_factor_required"`
+		ChallengeToken    *data.Token `json:"challenge_token"`
+	}
+	output.TwoFactorRequired = true
+	output.ChallengeToken = token
+
+	if err = ujson.Write(w, http.StatusAccepted, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+// checkSecondFactor accepts either a TOTP code or one of the recovery codes of the user.
+func (h *Handler) checkSecondFactor(userID int64, code, recoveryCode string) error {
+	v := validator.New()
+
+	v.Check(code != "" || recoveryCode != "", "code", "must be provided")
+	v.Check(code == "" || recoveryCode == "", "code", "must not be provided along with a recovery code")
+
+	if code != "" {
+		data.ValidateTOTPCode(v, code)
+	}
+
+	if !v.Valid() {
+		return erro.NewValidationErr("code validation", v.Errors)
+	}
+
+	if recoveryCode != "" {
+		err := h.Models.TwoFactor.UseRecoveryCode(userID, data.NormalizeRecoveryCode(recoveryCode))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return erro.Unauthorized.WithMessage("invalid or already used recovery code")
+			default:
+				return erro.ThrowInternalServer("use recovery code", err)
+			}
+		}
+
+		return nil
+	}
+
+	ok, err := h.verifyTOTP(userID, code)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+
+	if !ok {
+		return erro.Unauthorized.WithMessage("invalid or expired code")
+	}
+
+	return nil
+}
+
+// verifyTOTP checks the code against the secret of the user, allowing one step of clock
+// drift, and burns the step so the code cannot be replayed.
+func (h *Handler) verifyTOTP(userID int64, code string) (bool, error) {
+	secret, err := h.Models.TwoFactor.GetSecret(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, err
+		default:
+			return false, erro.ThrowInternalServer("get totp secret", err)
+		}
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	if err = h.Models.TwoFactor.UseStep(userID, step); err != nil {
+		switch {
+		case errors.Is(err, data.ErrCodeReused):
+			return false, nil
+		default:
+			return false, erro.ThrowInternalServer("use totp step", err)
+		}
+	}
+
+	return true, nil
+}
@@ -36,36 +36,38 @@ func (h *Handler) registerUserHandler(w http.ResponseWriter, r *http.Request) er
 
 	v := validator.New()
 
-	if user.Validate(v); !v.Valid() {
+	user.Validate(v)
+	h.Config.Passwords.Validate(v, user)
+
+	if !v.Valid() {
 		return erro.NewValidationErr("user validation", v.Errors)
 	}
 
-	err = h.Models.Users.Insert(user)
+	err = h.createUser(user)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "user with this email address already exists")
 			return erro.NewValidationErr("user insert", v.Errors)
 		default:
-			return erro.ThrowInternalServer("user insert", err)
+			return err
 		}
 	}
 
-	if err = h.Models.Permission.AddForUser(user.ID, data.PermissionMovieRead); err != nil {
-		return erro.Throw(erro.InternalServer, erro.Cause("add permission", err))
-	}
-
 	token, err := h.Models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
 	if err != nil {
 		return erro.ThrowInternalServer("create token", err)
 	}
 
+	h.sendMail(string(user.Email), "user_welcome.tmpl", map[string]any{
+		"activationToken": token.Plaintext,
+		"userID":          user.ID,
+	})
+
 	var output struct {
-		User  *data.User `json:"user"`
-		Token string     `json:"token"`
+		User *data.User `json:"user"`
 	}
 	output.User = user
-	output.Token = token.Plaintext
 
 	if err = ujson.Write(w, http.StatusCreated, output, nil); err != nil {
 		return erro.Throw(erro.InternalServer, erro.Cause("output response", err))
@@ -123,3 +125,263 @@ func (h *Handler) activateUserHandler(w http.ResponseWriter, r *http.Request) er
 
 	return nil
 }
+
+func (h *Handler) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	if data.ValidateToken(v, input.TokenPlaintext); !v.Valid() {
+		return erro.NewValidationErr("token validation", v.Errors)
+	}
+
+	user, err := h.Models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			return erro.NewValidationErr("get user by token", v.Errors)
+		default:
+			return erro.ThrowInternalServer("get user by token", err)
+		}
+	}
+
+	if err = user.Password.Set(input.Password); err != nil {
+		return erro.ThrowInternalServer("setting password", err)
+	}
+
+	user.Validate(v)
+	h.Config.Passwords.Validate(v, user)
+
+	if !v.Valid() {
+		return erro.NewValidationErr("user validation", v.Errors)
+	}
+
+	err = h.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Throw(erro.Conflict, erro.Cause("update user", err))
+		default:
+			return erro.ThrowInternalServer("update user", err)
+		}
+	}
+
+	if err = h.Models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	if err = h.Models.Tokens.DeleteAllSessionsForUser(user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	var output struct {
+		Message string `json:"message"`
+	}
+	output.Message = "your password was successfully reset"
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) error {
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := h.Models.Permission.GetAllForUser(user.ID)
+	if err != nil {
+		return erro.ThrowInternalServer("get user permissions", err)
+	}
+
+	var output struct {
+		User        *data.User       `json:"user"`
+		Permissions data.Permissions `json:"permissions"`
+	}
+	output.User = user
+	output.Permissions = permissions
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	v := validator.New()
+
+	if user.Validate(v); !v.Valid() {
+		return erro.NewValidationErr("user validation", v.Errors)
+	}
+
+	err = h.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Throw(erro.Conflict, erro.Cause("update user", err))
+		default:
+			return erro.ThrowInternalServer("update user", err)
+		}
+	}
+
+	var output struct {
+		User *data.User `json:"user"`
+	}
+	output.User = user
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+func (h *Handler) changeCurrentUserPasswordHandler(w http.ResponseWriter, r *http.Request) error {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password"`
+	}
+
+	if err := ujson.Read(w, r, &input); err != nil {
+		return erro.BadRequest.WithMessage(err.Error())
+	}
+
+	v := validator.New()
+
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+
+	if !v.Valid() {
+		return erro.NewValidationErr("password validation", v.Errors)
+	}
+
+	user, err := h.currentUser(r)
+	if err != nil {
+		return err
+	}
+
+	if user.ServiceAccount {
+		return erro.Forbidden.WithMessage("service accounts authenticate with api keys")
+	}
+
+	match, err := user.Password.Matches(input.CurrentPassword)
+	if err != nil {
+		return erro.ThrowInternalServer("matching password", err)
+	}
+
+	if !match {
+		v.AddError("current_password", "is incorrect")
+		return erro.NewValidationErr("password validation", v.Errors)
+	}
+
+	if err = user.Password.Set(input.Password); err != nil {
+		return erro.ThrowInternalServer("setting password", err)
+	}
+
+	user.Validate(v)
+	h.Config.Passwords.Validate(v, user)
+
+	if !v.Valid() {
+		return erro.NewValidationErr("user validation", v.Errors)
+	}
+
+	family, err := h.currentFamily(r)
+	if err != nil {
+		return err
+	}
+
+	err = h.Models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return erro.Throw(erro.Conflict, erro.Cause("update user", err))
+		default:
+			return erro.ThrowInternalServer("update user", err)
+		}
+	}
+
+	if err = h.Models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	if err = h.Models.Tokens.DeleteOtherSessionsForUser(user.ID, family); err != nil {
+		return erro.ThrowInternalServer("delete user tokens", err)
+	}
+
+	var output struct {
+		Message string `json:"message"`
+	}
+	output.Message = "your password was successfully changed"
+
+	if err = ujson.Write(w, http.StatusOK, output, nil); err != nil {
+		return erro.ThrowInternalServer("output response", err)
+	}
+
+	return nil
+}
+
+// currentUser loads the authenticated user from the database, as the user in the request
+// context only carries the claims of the access token in stateless mode.
+func (h *Handler) currentUser(r *http.Request) (*data.User, error) {
+	user, err := h.Models.Users.Get(h.App.ContextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, erro.Unauthorized.WithMessage("invalid or expired authorization token")
+		default:
+			return nil, erro.ThrowInternalServer("get user", err)
+		}
+	}
+
+	return user, nil
+}
+
+// createUser inserts the user and assigns it the default role. A duplicate email is
+// returned as data.ErrDuplicateEmail for the caller to report, any other failure as an
+// internal server error.
+func (h *Handler) createUser(user *data.User) error {
+	if err := h.Models.Users.Insert(user); err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			return err
+		default:
+			return erro.ThrowInternalServer("user insert", err)
+		}
+	}
+
+	if h.Config.DefaultRole != "" {
+		if err := h.Models.Roles.AddForUser(user.ID, h.Config.DefaultRole); err != nil {
+			return erro.ThrowInternalServer("add role", err)
+		}
+	}
+
+	return nil
+}
@@ -3,17 +3,25 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"runtime"
+	"slices"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/hvpaiva/greenlight/cmd/api/app"
 	"github.com/hvpaiva/greenlight/cmd/api/handler"
+	"github.com/hvpaiva/greenlight/internal/auth"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/internal/mailer"
+	"github.com/hvpaiva/greenlight/pkg/jwt"
 	"github.com/hvpaiva/greenlight/pkg/vcs"
 )
 
@@ -39,8 +47,63 @@ func main() {
 		}
 	}(db)
 
+	m, err := newMailer(cfg.mailer, cfg.env)
+	if err != nil {
+		logger.Error("mailer failed to initialize", slog.String("erro", err.Error()))
+		os.Exit(1)
+	}
+
 	a := app.New(logger, cfg.env, cfg.version, cfg.cors.trustedOrigins)
-	h := handler.New(a, db, &cfg.limiter)
+
+	if cfg.passwords.blocklist != "" {
+		cfg.passwords.policy.Blocklist, err = data.LoadPasswordBlocklist(cfg.passwords.blocklist, 0.001)
+		if err != nil {
+			logger.Error("password blocklist failed to load", slog.String("erro", err.Error()))
+			os.Exit(1)
+		}
+
+		logger.Info("password blocklist loaded", slog.Int("passwords", cfg.passwords.policy.Blocklist.Len()))
+	}
+
+	j, err := newJWT(a, cfg.jwt)
+	if err != nil {
+		logger.Error("jwt failed to initialize", slog.String("erro", err.Error()))
+		os.Exit(1)
+	}
+
+	cfg.auth.JWT = j
+	cfg.middleware.JWT = j
+
+	cfg.auth.OIDC, err = newOIDC(cfg.oidc)
+	if err != nil {
+		logger.Error("oidc failed to initialize", slog.String("erro", err.Error()))
+		os.Exit(1)
+	}
+
+	h := handler.New(a, db, m, handler.Config{
+		Middleware:  cfg.middleware,
+		Similar:     cfg.similar,
+		StatsTTL:    cfg.stats.ttl,
+		MailRetry:   cfg.mailer.retries,
+		Activation:  cfg.activation,
+		Auth:        cfg.auth,
+		Lockout:     cfg.lockout,
+		Deletion:    cfg.deletion,
+		DefaultRole: cfg.roles.defaultRole,
+		Passwords:   cfg.passwords.policy,
+	})
+
+	if cfg.roles.defaultRole != "" {
+		if _, err = h.Models.Roles.GetByName(cfg.roles.defaultRole); err != nil {
+			logger.Error("default role failed to load", slog.String("role", cfg.roles.defaultRole), slog.String("erro", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	if err = h.Middleware.ListenPermissionChanges(cfg.db.dsn); err != nil {
+		logger.Error("permissions listener failed to start", slog.String("erro", err.Error()))
+		os.Exit(1)
+	}
 
 	publishMetrics(db, cfg)
 
@@ -71,6 +134,110 @@ func openDB(dbConfig dbConfig) (*sql.DB, error) {
 	return db, nil
 }
 
+func newMailer(c mailerConfig, env string) (*mailer.Mailer, error) {
+	if c.retries < 1 {
+		return nil, errors.New("mailer-retries must be at least 1")
+	}
+
+	var sender mailer.Sender
+
+	switch c.transport {
+	case "smtp":
+		if c.smtp.host == "" {
+			return nil, errors.New("smtp-host must be provided for the smtp mailer transport")
+		}
+
+		sender = &mailer.SMTPSender{
+			Host:     c.smtp.host,
+			Port:     c.smtp.port,
+			Username: c.smtp.username,
+			Password: c.smtp.password,
+			Timeout:  c.smtp.timeout,
+		}
+	case "file":
+		sender = &mailer.FileSender{Dir: c.dir}
+	case "stdout":
+		if env != "development" {
+			return nil, errors.New("the stdout mailer transport is only allowed with env=development")
+		}
+
+		sender = &mailer.FileSender{Out: os.Stdout}
+	default:
+		return nil, fmt.Errorf("unknown mailer transport %q", c.transport)
+	}
+
+	return mailer.New(sender, c.sender), nil
+}
+
+func newJWT(a *app.Application, c jwtConfig) (*auth.JWT, error) {
+	switch c.mode {
+	case "stateful":
+		return nil, nil
+	case "jwt":
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", c.mode)
+	}
+
+	keys, err := jwt.LoadKeySet(c.jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := keys.Key(c.kid); !ok || !key.CanSign() {
+		return nil, fmt.Errorf("jwt-kid %q must name a JWKS key holding private key material", c.kid)
+	}
+
+	switch {
+	case c.reloadInterval < 0:
+		return nil, errors.New("jwt-reload-interval must not be negative")
+	case c.reloadInterval > 0:
+		a.Schedule("reload jwks", c.reloadInterval, func() error {
+			reloaded, err := keys.Reload()
+			if err != nil {
+				return err
+			}
+
+			if reloaded {
+				a.Logger.Info("jwks reloaded", slog.String("path", c.jwks))
+			}
+
+			return nil
+		})
+	}
+
+	return &auth.JWT{
+		Keys:       keys,
+		SigningKey: c.kid,
+		Issuer:     c.issuer,
+		Audience:   c.audience,
+	}, nil
+}
+
+func newOIDC(c oidcConfig) (*auth.OIDC, error) {
+	if c.issuer == "" {
+		return nil, nil
+	}
+
+	if c.clientID == "" || c.redirectURL == "" {
+		return nil, errors.New("oidc-client-id and oidc-redirect-url must be provided along with oidc-issuer")
+	}
+
+	scopes := strings.Fields(c.scopes)
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	return &auth.OIDC{
+		Issuer:       c.issuer,
+		ClientID:     c.clientID,
+		ClientSecret: c.clientSecret,
+		RedirectURL:  c.redirectURL,
+		Scopes:       scopes,
+		KeysTTL:      c.keysTTL,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
 func publishMetrics(db *sql.DB, c config) {
 	expvar.NewString("version").Set(c.version)
 	expvar.NewString("env").Set(c.env)
@@ -7,6 +7,7 @@ import (
 
 	"github.com/hvpaiva/greenlight/cmd/api/erro"
 	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/jwt"
 	"github.com/hvpaiva/greenlight/pkg/validator"
 )
 
@@ -24,6 +25,12 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authHeader, " ")
+
+		if len(headerParts) == 2 && headerParts[0] == "ApiKey" {
+			m.authenticateAPIKey(next, w, r, headerParts[1])
+			return
+		}
+
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			erro.Handle(m.App, w, r, erro.Unauthorized.WithMessage("invalid or malformed authorization header"))
 			return
@@ -31,6 +38,11 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		if m.JWT != nil && jwt.IsJWT(token) {
+			m.authenticateJWT(next, w, r, token)
+			return
+		}
+
 		v := validator.New()
 
 		if data.ValidateToken(v, token); !v.Valid() {
@@ -49,51 +61,208 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if user.Suspended {
+			erro.Handle(m.App, w, r, erro.Forbidden.WithMessage("your account has been suspended"))
+			return
+		}
+
+		if err = m.Models.Tokens.Touch(data.TokenHash(token), m.SessionTouch); err != nil {
+			m.App.Logger.Error("failed to record token usage", "error", err.Error())
+		}
+
 		r = m.App.ContextSetUser(r, user)
+		r = m.App.ContextSetToken(r, token)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (m *Middleware) Authorize(permission string) func(handler http.Handler) http.Handler {
-	return func(handler http.Handler) http.Handler {
-		fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user := m.App.ContextGetUser(r)
+func (m *Middleware) authenticateJWT(next http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	claims, err := m.JWT.Verify(token)
+	if err != nil {
+		erro.Handle(m.App, w, r, erro.Throw(erro.Unauthorized.WithMessage("invalid or expired authorization token"), erro.Cause("verify jwt", err)))
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		erro.Handle(m.App, w, r, erro.Unauthorized.WithMessage("invalid or malformed authorization token"))
+		return
+	}
+
+	suspended, err := m.userSuspended(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			erro.Handle(m.App, w, r, erro.Unauthorized.WithMessage("invalid or expired authorization token"))
+		default:
+			erro.Handle(m.App, w, r, erro.ThrowInternalServer("get user suspension", err))
+		}
+		return
+	}
+
+	if suspended {
+		erro.Handle(m.App, w, r, erro.Forbidden.WithMessage("your account has been suspended"))
+		return
+	}
+
+	user := &data.User{
+		ID:               userID,
+		Activated:        claims.Activated,
+		TwoFactorEnabled: claims.TwoFactor,
+	}
+
+	r = m.App.ContextSetUser(r, user)
+	r = m.App.ContextSetToken(r, token)
+	r = m.App.ContextSetPermissions(r, claims.Permissions)
+
+	next.ServeHTTP(w, r)
+}
+
+func (m *Middleware) authenticateAPIKey(next http.Handler, w http.ResponseWriter, r *http.Request, plaintext string) {
+	v := validator.New()
+
+	if data.ValidateAPIKey(v, plaintext); !v.Valid() {
+		erro.Handle(m.App, w, r, erro.Unauthorized.WithMessage("invalid or malformed api key"))
+		return
+	}
+
+	user, key, err := m.Models.APIKeys.GetForKey(plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			erro.Handle(m.App, w, r, erro.Unauthorized.WithMessage("invalid or expired api key"))
+		default:
+			erro.Handle(m.App, w, r, erro.ThrowInternalServer("get user api key", err))
+		}
+		return
+	}
+
+	if user.Suspended {
+		erro.Handle(m.App, w, r, erro.Forbidden.WithMessage("your account has been suspended"))
+		return
+	}
+
+	permissions, err := m.userPermissions(user.ID)
+	if err != nil {
+		erro.Handle(m.App, w, r, erro.ThrowInternalServer("get user permissions", err))
+		return
+	}
+
+	if err = m.Models.APIKeys.Touch(key.ID, m.SessionTouch); err != nil {
+		m.App.Logger.Error("failed to record api key usage", "error", err.Error())
+	}
+
+	r = m.App.ContextSetUser(r, user)
+	r = m.App.ContextSetToken(r, plaintext)
+	r = m.App.ContextSetPermissions(r, key.Scope(permissions))
+
+	next.ServeHTTP(w, r)
+}
 
-			if user.IsAnonymous() {
-				erro.Handle(m.App, w, r, erro.Unauthorized.WithMessage("authentication required"))
+func (m *Middleware) RequireAuthenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := m.App.ContextGetUser(r)
+
+		if user.IsAnonymous() {
+			erro.Handle(m.App, w, r, erro.Unauthorized.WithMessage("authentication required"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (m *Middleware) RequireActivated(next http.Handler) http.Handler {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := m.App.ContextGetUser(r)
+
+		if !user.Activated {
+			erro.Handle(m.App, w, r, erro.Forbidden.WithMessage("user not activated"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return m.RequireAuthenticated(fn)
+}
+
+// RequireTwoFactor rejects users holding a permission that requires two-factor
+// authentication, when they have not enabled it yet.
+func (m *Middleware) RequireTwoFactor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.App.ContextGetUser(r).TwoFactorEnabled {
+			required, err := m.TwoFactorRequired(r)
+			if err != nil {
+				erro.Handle(m.App, w, r, erro.ThrowInternalServer("check two-factor requirement", err))
 				return
 			}
 
-			if !user.Activated {
-				erro.Handle(m.App, w, r, erro.Forbidden.WithMessage("user not activated"))
+			if required {
+				erro.Handle(m.App, w, r, erro.Forbidden.WithMessage("two-factor authentication must be enabled for this account"))
 				return
 			}
+		}
 
-			handler.ServeHTTP(w, r)
-		})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// TwoFactorRequired reports whether the authenticated user holds any permission that
+// requires two-factor authentication. Service accounts are never required to use it.
+func (m *Middleware) TwoFactorRequired(r *http.Request) (bool, error) {
+	if m.App.ContextGetUser(r).ServiceAccount {
+		return false, nil
+	}
+
+	permissions, err := m.Permissions(r)
+	if err != nil {
+		return false, err
+	}
+
+	required, err := m.twoFactorPermissions()
+	if err != nil {
+		return false, err
+	}
+
+	return permissions.ContainsAny(required...), nil
+}
 
-		return m.CheckPermissions(permission)(fn)
+// Authorize lets the request through when the user holds any of the permissions.
+func (m *Middleware) Authorize(permissions ...string) func(handler http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return m.RequireActivated(m.RequireTwoFactor(m.CheckPermissions(permissions...)(handler)))
 	}
 }
 
-func (m *Middleware) CheckPermissions(permission string) func(next http.Handler) http.Handler {
+func (m *Middleware) CheckPermissions(required ...string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			user := m.App.ContextGetUser(r)
-
-			permissions, err := m.Models.Permission.GetAllForUser(user.ID)
+			permissions, err := m.Permissions(r)
 			if err != nil {
 				erro.Handle(m.App, w, r, erro.ThrowInternalServer("get user permissions", err))
 				return
 			}
 
-			if !permissions.Contains(permission) {
+			if !permissions.ContainsAny(required...) {
 				erro.Handle(m.App, w, r, erro.Forbidden.WithMessage("user does not have the required permission"))
 				return
 			}
 
+			r = m.App.ContextSetPermissions(r, permissions)
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// Permissions returns the permissions of the authenticated user, taken from the request
+// context when the credential carries them and from the database otherwise.
+func (m *Middleware) Permissions(r *http.Request) (data.Permissions, error) {
+	if permissions, ok := m.App.ContextGetPermissions(r); ok {
+		return permissions, nil
+	}
+
+	return m.userPermissions(m.App.ContextGetUser(r).ID)
+}
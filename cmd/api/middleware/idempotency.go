@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hvpaiva/greenlight/cmd/api/erro"
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/uhttp"
+)
+
+type Idempotency struct {
+	TTL time.Duration
+}
+
+// Idempotent stores the response to a request carrying an Idempotency-Key header and
+// replays it when the request is retried with the same key. Keys are scoped to the user.
+// Anonymous requests have no user to scope them to, so their keys are scoped to the
+// request payload instead: the same key sent with another payload is a new request.
+func (m *Middleware) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		user := m.App.ContextGetUser(r)
+
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			erro.Handle(m.App, w, r, erro.BadRequest.WithMessage("idempotency key must not be more than 255 bytes long"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+		if err != nil {
+			erro.Handle(m.App, w, r, erro.BadRequest.WithMessage("request body must not be larger than 1048576 bytes"))
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		record := &data.IdempotencyKey{
+			Key:         key,
+			UserID:      user.ID,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Fingerprint: fingerprint(r, body),
+			Expiry:      time.Now().Add(m.Idempotency.TTL),
+		}
+
+		if user.IsAnonymous() {
+			record.Key = key + ":" + hex.EncodeToString(record.Fingerprint)
+		}
+
+		reserved, err := m.Models.Idempotency.Reserve(record)
+		if err != nil {
+			erro.Handle(m.App, w, r, erro.ThrowInternalServer("reserve idempotency key", err))
+			return
+		}
+
+		if !reserved {
+			m.replay(w, r, record)
+			return
+		}
+
+		defer func() {
+			if err := recover(); err != nil {
+				_ = m.Models.Idempotency.Delete(record)
+				panic(err)
+			}
+		}()
+
+		rw := uhttp.NewRecordingResponseWriter(w)
+
+		next.ServeHTTP(rw, r)
+
+		if rw.StatusCode >= http.StatusInternalServerError {
+			if err = m.Models.Idempotency.Delete(record); err != nil {
+				m.App.Logger.Error("failed to release idempotency key", "error", err.Error())
+			}
+			return
+		}
+
+		record.StatusCode = rw.StatusCode
+		record.Header = rw.Header().Clone()
+		record.Body = rw.Body.Bytes()
+
+		if err = m.Models.Idempotency.Complete(record); err != nil {
+			m.App.Logger.Error("failed to store idempotent response", "error", err.Error())
+		}
+	})
+}
+
+func (m *Middleware) replay(w http.ResponseWriter, r *http.Request, record *data.IdempotencyKey) {
+	stored, err := m.Models.Idempotency.Get(record.Key, record.UserID, record.Method, record.Path)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			erro.Handle(m.App, w, r, erro.Conflict.WithMessage("the idempotency key has just expired, please try again"))
+		default:
+			erro.Handle(m.App, w, r, erro.ThrowInternalServer("get idempotency key", err))
+		}
+		return
+	}
+
+	if !bytes.Equal(stored.Fingerprint, record.Fingerprint) {
+		erro.Handle(m.App, w, r, erro.UnprocessableEntity.WithMessage("idempotency key was already used with a different request payload"))
+		return
+	}
+
+	if !stored.Completed() {
+		erro.Handle(m.App, w, r, erro.Conflict.WithMessage("a request with this idempotency key is still being processed"))
+		return
+	}
+
+	for k, values := range stored.Header {
+		w.Header()[k] = values
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.StatusCode)
+
+	_, _ = w.Write(stored.Body)
+}
+
+func fingerprint(r *http.Request, body []byte) []byte {
+	hash := sha256.New()
+
+	hash.Write([]byte(r.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(r.URL.Path))
+	hash.Write([]byte{0})
+	hash.Write(body)
+
+	return hash.Sum(nil)
+}
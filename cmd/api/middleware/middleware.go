@@ -2,23 +2,61 @@ package middleware
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/hvpaiva/greenlight/cmd/api/app"
+	"github.com/hvpaiva/greenlight/internal/auth"
 	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/cache"
 )
 
 type Middleware struct {
-	App     *app.Application
-	Models  *data.Models
-	Limiter *Limiter
+	App          *app.Application
+	Models       *data.Models
+	Limiter      *Limiter
+	Idempotency  Idempotency
+	SessionTouch time.Duration
+	JWT          *auth.JWT
+
+	permissions *cache.Cache[int64, data.Permissions]
+	twoFactor   *cache.Cache[struct{}, data.Permissions]
+	suspended   *cache.Cache[int64, bool]
+}
+
+type Config struct {
+	Limiter        Limiter
+	Idempotency    Idempotency
+	SessionTouch   time.Duration
+	JWT            *auth.JWT
+	PermissionsTTL time.Duration
 }
 
 type Func func(next http.Handler) http.Handler
 
-func New(app *app.Application, models *data.Models, limiter *Limiter) *Middleware {
-	return &Middleware{
-		App:     app,
-		Models:  models,
-		Limiter: limiter,
+func New(app *app.Application, models *data.Models, cfg Config) *Middleware {
+	m := &Middleware{
+		App:          app,
+		Models:       models,
+		Limiter:      &cfg.Limiter,
+		Idempotency:  cfg.Idempotency,
+		SessionTouch: cfg.SessionTouch,
+		JWT:          cfg.JWT,
+	}
+
+	app.Schedule("delete expired idempotency keys", time.Hour, models.Idempotency.DeleteExpired)
+
+	if cfg.PermissionsTTL > 0 {
+		m.permissions = cache.New[int64, data.Permissions](cfg.PermissionsTTL)
+		m.twoFactor = cache.New[struct{}, data.Permissions](cfg.PermissionsTTL)
+		m.suspended = cache.New[int64, bool](cfg.PermissionsTTL)
+
+		app.Schedule("evict permissions cache", cfg.PermissionsTTL, func() error {
+			m.permissions.DeleteExpired()
+			m.twoFactor.DeleteExpired()
+			m.suspended.DeleteExpired()
+			return nil
+		})
 	}
+
+	return m
 }
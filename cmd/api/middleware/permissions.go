@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"expvar"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/hvpaiva/greenlight/internal/data"
+)
+
+var (
+	permissionsCacheHits   = expvar.NewInt("permissions_cache_hits")
+	permissionsCacheMisses = expvar.NewInt("permissions_cache_misses")
+)
+
+// userPermissions returns the permissions of the user, from the cache when it is enabled.
+func (m *Middleware) userPermissions(userID int64) (data.Permissions, error) {
+	if m.permissions == nil {
+		return m.Models.Permission.GetAllForUser(userID)
+	}
+
+	if permissions, ok := m.permissions.Get(userID); ok {
+		permissionsCacheHits.Add(1)
+		return permissions, nil
+	}
+
+	permissionsCacheMisses.Add(1)
+
+	// The permissions are only cached when not invalidated while they were being loaded,
+	// since they may predate the change.
+	generation := m.permissions.Generation()
+
+	permissions, err := m.Models.Permission.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.permissions.SetIfCurrent(userID, permissions, generation)
+
+	return permissions, nil
+}
+
+// twoFactorPermissions returns the permissions whose holders must use two-factor
+// authentication, cached along with the permissions of the users.
+func (m *Middleware) twoFactorPermissions() (data.Permissions, error) {
+	if m.twoFactor == nil {
+		return m.Models.TwoFactor.GetRequiredPermissions()
+	}
+
+	if permissions, ok := m.twoFactor.Get(struct{}{}); ok {
+		return permissions, nil
+	}
+
+	generation := m.twoFactor.Generation()
+
+	permissions, err := m.Models.TwoFactor.GetRequiredPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	m.twoFactor.SetIfCurrent(struct{}{}, permissions, generation)
+
+	return permissions, nil
+}
+
+// userSuspended reports whether the user is suspended, from the cache when it is enabled.
+// Access tokens signed as JWTs are checked against it, so a suspension applies to them
+// before they expire.
+func (m *Middleware) userSuspended(userID int64) (bool, error) {
+	if m.suspended == nil {
+		return m.Models.Users.IsSuspended(userID)
+	}
+
+	if suspended, ok := m.suspended.Get(userID); ok {
+		return suspended, nil
+	}
+
+	generation := m.suspended.Generation()
+
+	suspended, err := m.Models.Users.IsSuspended(userID)
+	if err != nil {
+		return false, err
+	}
+
+	m.suspended.SetIfCurrent(userID, suspended, generation)
+
+	return suspended, nil
+}
+
+// InvalidatePermissions drops the cached permissions and suspension of the users, or of
+// every user along with the permissions requiring two-factor authentication when none is
+// given.
+func (m *Middleware) InvalidatePermissions(userIDs ...int64) {
+	if m.permissions == nil {
+		return
+	}
+
+	if len(userIDs) == 0 {
+		m.permissions.Clear()
+		m.twoFactor.Clear()
+		m.suspended.Clear()
+		return
+	}
+
+	for _, id := range userIDs {
+		m.permissions.Delete(id)
+		m.suspended.Delete(id)
+	}
+}
+
+// ListenPermissionChanges invalidates the cached permissions whenever the database notifies
+// they changed, which keeps the caches of every API instance sharing the database in sync.
+func (m *Middleware) ListenPermissionChanges(dsn string) error {
+	if m.permissions == nil {
+		return nil
+	}
+
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(_ pq.ListenerEventType, err error) {
+		if err != nil {
+			m.App.Logger.Error("permissions listener failed", "error", err.Error())
+		}
+	})
+
+	if err := listener.Listen(data.PermissionsChannel); err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	m.App.Background(func() {
+		defer listener.Close()
+
+		ticker := time.NewTicker(90 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.App.Done():
+				return
+			case n := <-listener.Notify:
+				m.handlePermissionsNotification(n)
+			case <-ticker.C:
+				go func() {
+					_ = listener.Ping()
+				}()
+			}
+		}
+	})
+
+	return nil
+}
+
+func (m *Middleware) handlePermissionsNotification(n *pq.Notification) {
+	// A nil notification follows a reconnection, after which changes may have been missed.
+	if n == nil || n.Extra == "" {
+		m.InvalidatePermissions()
+		return
+	}
+
+	userID, err := strconv.ParseInt(n.Extra, 10, 64)
+	if err != nil {
+		m.App.Logger.Error("invalid permissions notification", "payload", n.Extra)
+		m.InvalidatePermissions()
+		return
+	}
+
+	m.InvalidatePermissions(userID)
+}
@@ -42,6 +42,7 @@ func serve(c config, a *app.Application, handler *handler.Handler) error {
 			shutdownError <- err
 		}
 
+		a.Shutdown()
 		a.Wg.Wait()
 		shutdownError <- nil
 	}()
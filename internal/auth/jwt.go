@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/hvpaiva/greenlight/internal/data"
+	"github.com/hvpaiva/greenlight/pkg/jwt"
+)
+
+// Claims is the payload of the access tokens issued in stateless mode. It carries
+// everything the API needs to authorize a request without a database lookup.
+type Claims struct {
+	jwt.RegisteredClaims
+	Permissions data.Permissions `json:"perms"`
+	Activated   bool             `json:"act"`
+	Session     string           `json:"sid,omitempty"`
+	TwoFactor   bool             `json:"tfa,omitempty"`
+}
+
+// UserID returns the user the token was issued to
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+// Family returns the refresh token family the token was issued for, if any
+func (c *Claims) Family() ([]byte, error) {
+	return hex.DecodeString(c.Session)
+}
+
+// JWT issues and verifies signed access tokens
+type JWT struct {
+	Keys       *jwt.KeySet
+	SigningKey string
+	Issuer     string
+	Audience   string
+}
+
+func (j *JWT) Issue(user *data.User, permissions data.Permissions, family []byte, ttl time.Duration) (*data.Token, error) {
+	key, ok := j.Keys.Key(j.SigningKey)
+	if !ok || !key.CanSign() {
+		return nil, errors.New("jwt signing key not available: " + j.SigningKey)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(ttl)
+
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.Issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.Audience{j.Audience},
+			ExpiresAt: expiry.Unix(),
+			NotBefore: now.Unix(),
+			IssuedAt:  now.Unix(),
+			ID:        base64.RawURLEncoding.EncodeToString(id),
+		},
+		Permissions: permissions,
+		Activated:   user.Activated,
+		Session:     hex.EncodeToString(family),
+		TwoFactor:   user.TwoFactorEnabled,
+	}
+
+	signed, err := jwt.Sign(claims, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{
+		Plaintext: signed,
+		UserID:    user.ID,
+		Expiry:    expiry,
+		Scope:     data.ScopeAuthentication,
+		Family:    family,
+	}, nil
+}
+
+func (j *JWT) Verify(token string) (*Claims, error) {
+	var claims Claims
+
+	err := jwt.Parse(token, j.Keys, &claims, jwt.Expectations{
+		Issuer:   j.Issuer,
+		Audience: j.Audience,
+		Leeway:   30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
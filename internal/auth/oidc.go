@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hvpaiva/greenlight/pkg/jwt"
+)
+
+var (
+	ErrCodeRejected   = errors.New("authorization code rejected by the provider")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// keysRefreshInterval is the minimum interval between JWKS fetches triggered by ID tokens
+// signed with an unknown key, so forged tokens cannot make the API flood the provider.
+const keysRefreshInterval = time.Minute
+
+// IDClaims are the claims of the ID tokens issued by the provider
+type IDClaims struct {
+	jwt.RegisteredClaims
+	AuthorizedParty string `json:"azp,omitempty"`
+	Nonce           string `json:"nonce,omitempty"`
+	Email           string `json:"email,omitempty"`
+	EmailVerified   bool   `json:"email_verified,omitempty"`
+	Name            string `json:"name,omitempty"`
+}
+
+// Authorization is a sign in started by the API, to be completed once the provider
+// redirects the user back with a code. State, Nonce and Verifier must be kept until then.
+type Authorization struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+// OIDC signs users in with an external OpenID Connect provider through the authorization
+// code flow with PKCE. The provider configuration is discovered from the issuer on first
+// use and its JWKS is cached for KeysTTL.
+type OIDC struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	KeysTTL      time.Duration
+	Client       *http.Client
+
+	mu            sync.Mutex
+	provider      *provider
+	keys          *jwt.KeySet
+	keysFetchedAt time.Time
+}
+
+type provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Authorize starts a sign in, returning the provider URL the user must be sent to.
+func (o *OIDC) Authorize(ctx context.Context) (*Authorization, error) {
+	p, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Authorization{}
+
+	for _, v := range []*string{&a.State, &a.Nonce, &a.Verifier} {
+		if *v, err = randomString(); err != nil {
+			return nil, err
+		}
+	}
+
+	challenge := sha256.Sum256([]byte(a.Verifier))
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.ClientID},
+		"redirect_uri":          {o.RedirectURL},
+		"scope":                 {strings.Join(o.Scopes, " ")},
+		"state":                 {a.State},
+		"nonce":                 {a.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	a.URL = p.AuthorizationEndpoint + separator + query.Encode()
+
+	return a, nil
+}
+
+// Exchange redeems the code the provider redirected the user back with, and returns the
+// claims of the verified ID token.
+func (o *OIDC) Exchange(ctx context.Context, code, verifier, nonce string) (*IDClaims, error) {
+	p, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.RedirectURL},
+		"client_id":     {o.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if o.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.ClientID), url.QueryEscape(o.ClientSecret))
+	}
+
+	res, err := o.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err = json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint responded with status %d", res.StatusCode)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: %s %s", ErrCodeRejected, tokens.Error, tokens.ErrorDescription)
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("token endpoint responded with status %d", res.StatusCode)
+	case tokens.IDToken == "":
+		return nil, fmt.Errorf("%w: missing from the token response", ErrInvalidIDToken)
+	}
+
+	return o.verify(ctx, tokens.IDToken, nonce)
+}
+
+// verify checks the ID token was signed by the provider for this client and the sign in
+// identified by nonce.
+func (o *OIDC) verify(ctx context.Context, token, nonce string) (*IDClaims, error) {
+	keys, err := o.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims IDClaims
+
+	expect := jwt.Expectations{
+		Issuer:   o.Issuer,
+		Audience: o.ClientID,
+		Leeway:   time.Minute,
+	}
+
+	err = jwt.Parse(token, keys, &claims, expect)
+	if errors.Is(err, jwt.ErrUnknownKey) {
+		// The provider may have rotated its keys since they were cached.
+		if keys, err = o.keySet(ctx, true); err != nil {
+			return nil, err
+		}
+
+		err = jwt.Parse(token, keys, &claims, expect)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != o.ClientID:
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// discover returns the provider configuration, fetching it on first use. Fetches happen
+// outside the lock, so a slow provider does not hold up the sign ins that need no fetch.
+func (o *OIDC) discover(ctx context.Context) (*provider, error) {
+	o.mu.Lock()
+	cached := o.provider
+	o.mu.Unlock()
+
+	if cached != nil {
+		return cached, nil
+	}
+
+	var p provider
+
+	if err := o.getJSON(ctx, strings.TrimSuffix(o.Issuer, "/")+"/.well-known/openid-configuration", &p); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	switch {
+	case p.Issuer != o.Issuer:
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match the configured issuer", p.Issuer)
+	case p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "":
+		return nil, errors.New("oidc discovery: incomplete provider configuration")
+	}
+
+	o.mu.Lock()
+	o.provider = &p
+	o.mu.Unlock()
+
+	return &p, nil
+}
+
+// keySet returns the cached provider keys, fetching them again once they expire. When
+// refresh is set they are fetched again anyway, unless they were just fetched.
+func (o *OIDC) keySet(ctx context.Context, refresh bool) (*jwt.KeySet, error) {
+	p, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	cached, age := o.keys, time.Since(o.keysFetchedAt)
+	o.mu.Unlock()
+
+	if cached != nil && age < o.KeysTTL && (!refresh || age < keysRefreshInterval) {
+		return cached, nil
+	}
+
+	var raw json.RawMessage
+
+	if err = o.getJSON(ctx, p.JWKSURI, &raw); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys, err := jwt.ParseKeySet(raw)
+	if err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	o.mu.Lock()
+	o.keys = keys
+	o.keysFetchedAt = time.Now()
+	o.mu.Unlock()
+
+	return keys, nil
+}
+
+func (o *OIDC) getJSON(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := o.client().Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", url, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(dst)
+}
+
+func (o *OIDC) client() *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+
+	return http.DefaultClient
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hvpaiva/greenlight/internal/auth/oidctest"
+)
+
+func newTestOIDC(t *testing.T) (*OIDC, *oidctest.Provider) {
+	t.Helper()
+
+	idp := oidctest.New("greenlight", "s3cret")
+	t.Cleanup(idp.Close)
+
+	o := &OIDC{
+		Issuer:       idp.Issuer(),
+		ClientID:     idp.ClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  "https://greenlight.test/sso/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+		KeysTTL:      time.Hour,
+	}
+
+	return o, idp
+}
+
+// signIn starts a sign in, plays it at the provider with the claims and exchanges the code
+// with the verifier and nonce the API kept for it.
+func signIn(t *testing.T, o *OIDC, idp *oidctest.Provider, claims map[string]any) (*IDClaims, error) {
+	t.Helper()
+
+	a, err := o.Authorize(context.Background())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	code, state, err := idp.SignIn(a.URL, claims)
+	if err != nil {
+		t.Fatalf("sign in at provider: %v", err)
+	}
+
+	if state != a.State {
+		t.Fatalf("state = %q, want %q", state, a.State)
+	}
+
+	return o.Exchange(context.Background(), code, a.Verifier, a.Nonce)
+}
+
+func TestOIDCExchange(t *testing.T) {
+	o, idp := newTestOIDC(t)
+
+	claims, err := signIn(t, o, idp, map[string]any{
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada",
+	})
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if claims.Subject == "" || claims.Email != "ada@example.com" || !claims.EmailVerified || claims.Name != "Ada" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestOIDCExchangeRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+	}{
+		{name: "wrong nonce", claims: map[string]any{"nonce": "not-the-nonce"}},
+		{name: "wrong audience", claims: map[string]any{"aud": "another-client"}},
+		{name: "wrong authorized party", claims: map[string]any{"aud": []string{"greenlight", "another-client"}, "azp": "another-client"}},
+		{name: "missing authorized party", claims: map[string]any{"aud": []string{"greenlight", "another-client"}}},
+		{name: "wrong issuer", claims: map[string]any{"iss": "https://attacker.test"}},
+		{name: "expired", claims: map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "missing subject", claims: map[string]any{"sub": ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, idp := newTestOIDC(t)
+
+			if _, err := signIn(t, o, idp, tt.claims); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeAcceptsMultipleAudiencesWithAuthorizedParty(t *testing.T) {
+	o, idp := newTestOIDC(t)
+
+	_, err := signIn(t, o, idp, map[string]any{"aud": []string{"greenlight", "another-client"}, "azp": "greenlight"})
+	if err != nil {
+		t.Errorf("exchange: %v", err)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	o, idp := newTestOIDC(t)
+
+	a, err := o.Authorize(context.Background())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	code, _, err := idp.SignIn(a.URL, nil)
+	if err != nil {
+		t.Fatalf("sign in at provider: %v", err)
+	}
+
+	other, err := o.Authorize(context.Background())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	if _, err = o.Exchange(context.Background(), code, other.Verifier, a.Nonce); !errors.Is(err, ErrCodeRejected) {
+		t.Errorf("err = %v, want %v", err, ErrCodeRejected)
+	}
+}
+
+func TestOIDCExchangeRejectsReusedCode(t *testing.T) {
+	o, idp := newTestOIDC(t)
+
+	a, err := o.Authorize(context.Background())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	code, _, err := idp.SignIn(a.URL, nil)
+	if err != nil {
+		t.Fatalf("sign in at provider: %v", err)
+	}
+
+	if _, err = o.Exchange(context.Background(), code, a.Verifier, a.Nonce); err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+
+	if _, err = o.Exchange(context.Background(), code, a.Verifier, a.Nonce); !errors.Is(err, ErrCodeRejected) {
+		t.Errorf("err = %v, want %v", err, ErrCodeRejected)
+	}
+}
+
+func TestOIDCRefreshesKeysOnUnknownKid(t *testing.T) {
+	o, idp := newTestOIDC(t)
+
+	if _, err := signIn(t, o, idp, nil); err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	idp.RotateKey()
+
+	// Keys fetched moments ago are not fetched again, whatever kid a token names.
+	if _, err := signIn(t, o, idp, nil); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+
+	if fetches := idp.JWKSFetches(); fetches != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", fetches)
+	}
+
+	o.mu.Lock()
+	o.keysFetchedAt = time.Now().Add(-2 * keysRefreshInterval)
+	o.mu.Unlock()
+
+	if _, err := signIn(t, o, idp, nil); err != nil {
+		t.Fatalf("exchange after rotation: %v", err)
+	}
+
+	if fetches := idp.JWKSFetches(); fetches != 2 {
+		t.Errorf("jwks fetched %d times, want 2", fetches)
+	}
+}
+
+func TestOIDCCachesKeys(t *testing.T) {
+	o, idp := newTestOIDC(t)
+
+	for range 3 {
+		if _, err := signIn(t, o, idp, nil); err != nil {
+			t.Fatalf("exchange: %v", err)
+		}
+	}
+
+	if fetches := idp.JWKSFetches(); fetches != 1 {
+		t.Errorf("jwks fetched %d times, want 1", fetches)
+	}
+}
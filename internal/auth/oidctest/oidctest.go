@@ -0,0 +1,280 @@
+// Package oidctest runs an in-process OpenID Connect provider for tests of the single
+// sign-on flow.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Provider is a fake identity provider serving discovery, JWKS, authorization and token
+// endpoints. Its codes are single use and bound to the PKCE challenge and redirect URL of
+// the authorization request, as a real provider does.
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+
+	mu          sync.Mutex
+	key         *rsa.PrivateKey
+	kid         string
+	keys        int
+	grants      map[string]grant
+	jwksFetches int
+}
+
+type grant struct {
+	challenge   string
+	redirectURL string
+	claims      map[string]any
+}
+
+// New starts a provider for the client. Close must be called once done.
+func New(clientID, clientSecret string) *Provider {
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		grants:       make(map[string]grant),
+	}
+
+	p.RotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("GET /authorize", p.authorize)
+	mux.HandleFunc("POST /token", p.token)
+
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+func (p *Provider) Close() {
+	p.Server.Close()
+}
+
+// Issuer returns the issuer identifier of the provider
+func (p *Provider) Issuer() string {
+	return p.Server.URL
+}
+
+// RotateKey replaces the signing key with a new one, under a new kid.
+func (p *Provider) RotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.keys++
+	p.key = key
+	p.kid = "key-" + strconv.Itoa(p.keys)
+}
+
+// JWKSFetches returns how many times the JWKS was fetched
+func (p *Provider) JWKSFetches() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.jwksFetches
+}
+
+// SignIn plays the user signing in at the authorization URL, and returns the code and
+// state the provider redirects back with. The claims are added to the ID token issued for
+// the code, replacing the defaults (iss, sub, aud, exp, iat and nonce) they overlap.
+func (p *Provider) SignIn(authorizationURL string, claims map[string]any) (code, state string, err error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get(authorizationURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	_ = res.Body.Close()
+
+	if res.StatusCode != http.StatusFound {
+		return "", "", fmt.Errorf("authorization responded with status %d", res.StatusCode)
+	}
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+
+	code = location.Query().Get("code")
+
+	p.mu.Lock()
+	for k, v := range claims {
+		p.grants[code].claims[k] = v
+	}
+	p.mu.Unlock()
+
+	return code, location.Query().Get("state"), nil
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Issuer(),
+		"authorization_endpoint": p.Issuer() + "/authorize",
+		"token_endpoint":         p.Issuer() + "/token",
+		"jwks_uri":               p.Issuer() + "/jwks",
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.jwksFetches++
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": p.kid,
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			},
+		},
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+
+	p.mu.Lock()
+	p.grants[code] = grant{
+		challenge:   q.Get("code_challenge"),
+		redirectURL: q.Get("redirect_uri"),
+		claims: map[string]any{
+			"iss":   p.Issuer(),
+			"sub":   "subject-" + code[:8],
+			"aud":   p.ClientID,
+			"exp":   time.Now().Add(5 * time.Minute).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": q.Get("nonce"),
+		},
+	}
+	p.mu.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	id, secret, _ := r.BasicAuth()
+	if id != url.QueryEscape(p.ClientID) || secret != url.QueryEscape(p.ClientSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+
+	p.mu.Lock()
+	g, ok := p.grants[code]
+	delete(p.grants, code)
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code" || !ok:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case r.PostForm.Get("redirect_uri") != g.redirectURL:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "redirect_uri mismatch"})
+		return
+	case base64.RawURLEncoding.EncodeToString(challenge[:]) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier mismatch"})
+		return
+	}
+
+	idToken, err := p.sign(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Provider) sign(claims map[string]any) (string, error) {
+	p.mu.Lock()
+	key, kid := p.key, p.kid
+	p.mu.Unlock()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,256 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+const apiKeyPrefix = "glk_"
+
+var (
+	ErrDuplicateAPIKeyName = errors.New("duplicate api key name")
+)
+
+type APIKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Hash        []byte      `json:"-"`
+	Prefix      string      `json:"prefix"`
+	Expiry      *time.Time  `json:"expiry"`
+	Permissions Permissions `json:"permissions"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+}
+
+// Scope narrows the permissions of the key owner down to the permissions of the key. A key
+// without permissions of its own acts with every permission of its owner.
+func (k *APIKey) Scope(userPermissions Permissions) Permissions {
+	if len(k.Permissions) == 0 {
+		return userPermissions
+	}
+
+	scoped := make(Permissions, 0, len(k.Permissions))
+
+	for _, permission := range k.Permissions {
+		if userPermissions.Contains(permission) {
+			scoped = append(scoped, permission)
+		}
+	}
+
+	return scoped
+}
+
+func GenerateAPIKey(userID int64, name string, expiry *time.Time, permissions Permissions) (*APIKey, error) {
+	randomBytes := make([]byte, 20)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	plaintext := apiKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	if permissions == nil {
+		permissions = Permissions{}
+	}
+
+	return &APIKey{
+		UserID:      userID,
+		Name:        name,
+		Plaintext:   plaintext,
+		Hash:        TokenHash(plaintext),
+		Prefix:      plaintext[:len(apiKeyPrefix)+6],
+		Expiry:      expiry,
+		Permissions: permissions,
+	}, nil
+}
+
+func ValidateAPIKey(v *validator.Validator, key string) {
+	v.Check(strings.HasPrefix(key, apiKeyPrefix), "key", "must be a valid api key")
+	v.Check(len(key) == len(apiKeyPrefix)+32, "key", "must be 36 bytes long")
+}
+
+func (k *APIKey) Validate(v *validator.Validator) {
+	v.Check(k.Name != "", "name", "must be provided")
+	v.Check(len(k.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(k.Expiry == nil || k.Expiry.After(time.Now()), "expires_at", "must be in the future")
+	v.Check(validator.Unique(k.Permissions), "permissions", "must not contain duplicate values")
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+func (m APIKeyModel) Insert(key *APIKey) error {
+	query := `
+        INSERT INTO api_keys (user_id, name, hash, prefix, expiry, permissions)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id, created_at`
+
+	args := []any{key.UserID, key.Name, key.Hash, key.Prefix, key.Expiry, pq.Array(key.Permissions)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "api_keys_user_id_name_key"`:
+			return ErrDuplicateAPIKeyName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+        SELECT id, created_at, user_id, name, prefix, expiry, permissions, last_used_at
+        FROM api_keys
+        WHERE user_id = $1
+        ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	keys := make([]*APIKey, 0)
+
+	for rows.Next() {
+		var key APIKey
+		err = rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&key.Expiry,
+			pq.Array(&key.Permissions),
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForKey returns the key matching the plaintext along with its owner, provided the
+// key has not expired.
+func (m APIKeyModel) GetForKey(plaintext string) (*User, *APIKey, error) {
+	query := `
+        SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.suspended, u.service_account, u.totp_enabled, u.version,
+            k.id, k.created_at, k.user_id, k.name, k.prefix, k.expiry, k.permissions, k.last_used_at
+        FROM api_keys k
+        INNER JOIN users u ON u.id = k.user_id
+        WHERE k.hash = $1
+        AND (k.expiry IS NULL OR k.expiry > $2)`
+
+	var (
+		user User
+		key  APIKey
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, TokenHash(plaintext), time.Now()).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.ServiceAccount,
+		&user.TwoFactorEnabled,
+		&user.Version,
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.Expiry,
+		pq.Array(&key.Permissions),
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	return &user, &key, nil
+}
+
+// Touch records that the key was used, writing at most once per interval.
+func (m APIKeyModel) Touch(id int64, interval time.Duration) error {
+	query := `
+        UPDATE api_keys
+        SET last_used_at = NOW()
+        WHERE id = $1
+        AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, interval.Seconds())
+	return err
+}
+
+func (m APIKeyModel) Delete(userID, id int64) error {
+	query := `
+        DELETE FROM api_keys
+        WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
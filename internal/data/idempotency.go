@@ -0,0 +1,148 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+type IdempotencyKey struct {
+	Key         string
+	UserID      int64
+	Method      string
+	Path        string
+	Fingerprint []byte
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	Expiry      time.Time
+}
+
+// Completed reports whether the response for the key has already been stored
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Reserve claims the key for a new request. It returns false when a live record for
+// the key already exists, either completed or still being processed.
+func (m IdempotencyModel) Reserve(key *IdempotencyKey) (bool, error) {
+	query := `
+        INSERT INTO idempotency_keys (key, user_id, method, path, fingerprint, expiry)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        ON CONFLICT (key, user_id, method, path) DO UPDATE
+        SET fingerprint = EXCLUDED.fingerprint, status_code = NULL, headers = NULL, body = NULL,
+            created_at = NOW(), expiry = EXCLUDED.expiry
+        WHERE idempotency_keys.expiry <= NOW()`
+
+	args := []any{key.Key, key.UserID, key.Method, key.Path, key.Fingerprint, key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (m IdempotencyModel) Get(key string, userID int64, method, path string) (*IdempotencyKey, error) {
+	query := `
+        SELECT key, user_id, method, path, fingerprint, coalesce(status_code, 0), headers, body, expiry
+        FROM idempotency_keys
+        WHERE key = $1 AND user_id = $2 AND method = $3 AND path = $4
+        AND expiry > NOW()`
+
+	var (
+		record  IdempotencyKey
+		headers []byte
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, key, userID, method, path).Scan(
+		&record.Key,
+		&record.UserID,
+		&record.Method,
+		&record.Path,
+		&record.Fingerprint,
+		&record.StatusCode,
+		&headers,
+		&record.Body,
+		&record.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if headers != nil {
+		if err = json.Unmarshal(headers, &record.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return &record, nil
+}
+
+func (m IdempotencyModel) Complete(key *IdempotencyKey) error {
+	headers, err := json.Marshal(key.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        UPDATE idempotency_keys
+        SET status_code = $1, headers = $2, body = $3
+        WHERE key = $4 AND user_id = $5 AND method = $6 AND path = $7`
+
+	args := []any{key.StatusCode, headers, key.Body, key.Key, key.UserID, key.Method, key.Path}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (m IdempotencyModel) Delete(key *IdempotencyKey) error {
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE key = $1 AND user_id = $2 AND method = $3 AND path = $4`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, key.Key, key.UserID, key.Method, key.Path)
+	return err
+}
+
+func (m IdempotencyModel) DeleteExpired() error {
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE expiry <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
@@ -11,22 +11,44 @@ var (
 )
 
 const (
-	PermissionMovieRead  = "movies:read"
-	PermissionMovieWrite = "movies:write"
+	PermissionMovieRead     = "movies:read"
+	PermissionMovieWriteOwn = "movies:write:own"
+	PermissionMovieWriteAny = "movies:write:any"
+	PermissionStatsRead     = "stats:read"
+	PermissionTagModerate   = "tags:moderate"
+	PermissionUsersAdmin    = "users:admin"
 )
 
 type Models struct {
-	Movies     MovieModel
-	Users      UserModel
-	Tokens     TokenModel
-	Permission PermissionModel
+	Movies       MovieModel
+	Users        UserModel
+	Tokens       TokenModel
+	Permission   PermissionModel
+	Stats        StatsModel
+	Idempotency  IdempotencyModel
+	Tags         TagModel
+	APIKeys      APIKeyModel
+	TwoFactor    TwoFactorModel
+	Throttles    LoginThrottleModel
+	EmailChanges EmailChangeModel
+	Roles        RoleModel
+	OIDC         OIDCModel
 }
 
 func New(db *sql.DB) *Models {
 	return &Models{
-		Movies:     MovieModel{DB: db},
-		Users:      UserModel{DB: db},
-		Tokens:     TokenModel{DB: db},
-		Permission: PermissionModel{DB: db},
+		Movies:       MovieModel{DB: db},
+		Users:        UserModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Permission:   PermissionModel{DB: db},
+		Stats:        StatsModel{DB: db},
+		Idempotency:  IdempotencyModel{DB: db},
+		Tags:         TagModel{DB: db},
+		APIKeys:      APIKeyModel{DB: db},
+		TwoFactor:    TwoFactorModel{DB: db},
+		Throttles:    LoginThrottleModel{DB: db},
+		EmailChanges: EmailChangeModel{DB: db},
+		Roles:        RoleModel{DB: db},
+		OIDC:         OIDCModel{DB: db},
 	}
 }
@@ -19,10 +19,17 @@ type Movie struct {
 	Year      int32     `json:"year,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
 	Runtime   Runtime   `json:"runtime,omitempty"`
+	CreatedBy *int64    `json:"created_by"`
+	UpdatedBy *int64    `json:"updated_by"`
 	CreatedAt time.Time `json:"-"`
 	Version   int32     `json:"-"`
 }
 
+// OwnerID returns the user who created the movie, if known
+func (m *Movie) OwnerID() *int64 {
+	return m.CreatedBy
+}
+
 func (m *Movie) Validate(v *validator.Validator) {
 	if m == nil {
 		v.AddError("movie", "movie must be provided")
@@ -45,23 +52,34 @@ func (m *Movie) Validate(v *validator.Validator) {
 	v.Check(validator.Unique(m.Genres), "genres", "must not contain duplicate values")
 }
 
+type SimilarMovie struct {
+	*Movie
+	Score float64 `json:"score"`
+}
+
+type SimilarityWeights struct {
+	Genre   float64
+	Year    float64
+	Runtime float64
+}
+
 type MovieModel struct {
 	DB *sql.DB
 }
 
 func (m MovieModel) Insert(movie *Movie) error {
 	query := `
-		INSERT INTO movies (title, year, runtime, genres)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at
+		INSERT INTO movies (title, year, runtime, genres, created_by, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		RETURNING id, created_at, updated_by
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.CreatedBy}
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt)
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.UpdatedBy)
 }
 
 func (m MovieModel) Get(id int64) (*Movie, error) {
@@ -70,7 +88,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	}
 
 	query := `
-		SELECT id, title, year, runtime, genres, created_at, version
+		SELECT id, title, year, runtime, genres, created_by, updated_by, created_at, version
 		FROM movies
 		WHERE id = $1
 	`
@@ -86,6 +104,8 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		&movie.Year,
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
+		&movie.CreatedBy,
+		&movie.UpdatedBy,
 		&movie.CreatedAt,
 		&movie.Version,
 	); err != nil {
@@ -103,8 +123,8 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 func (m MovieModel) Update(movie *Movie) error {
 	query := `
         UPDATE movies 
-        SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET title = $1, year = $2, runtime = $3, genres = $4, updated_by = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version
 	`
 
@@ -113,6 +133,7 @@ func (m MovieModel) Update(movie *Movie) error {
 		movie.Year,
 		movie.Runtime,
 		pq.Array(movie.Genres),
+		movie.UpdatedBy,
 		movie.ID,
 		movie.Version,
 	}
@@ -162,19 +183,32 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filter filters.Filter) ([]*Movie, filters.Metadata, error) {
+func (m MovieModel) GetAll(title string, genres []string, tags []string, filter filters.Filter) ([]*Movie, filters.Metadata, error) {
 	query := fmt.Sprintf(`
-        SELECT count(*) OVER(), id, title, year, runtime, genres, created_at, version
+        SELECT count(*) OVER(), id, title, year, runtime, genres, created_by, updated_by, created_at, version
         FROM movies
         WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
         AND (genres @> $2 OR $2 = '{}')     
+        AND ($3::text[] = '{}' OR id IN (
+            SELECT s.movie_id
+            FROM (
+                SELECT mt.movie_id, mt.tag_id
+                FROM movies_tags mt
+                INNER JOIN tags t ON t.id = mt.tag_id
+                WHERE t.name = ANY($3::text[]) AND NOT t.banned
+                GROUP BY mt.movie_id, mt.tag_id
+                HAVING sum(mt.vote) > 0
+            ) s
+            GROUP BY s.movie_id
+            HAVING count(*) = cardinality($3::text[])
+        ))
         ORDER BY %s %s, id
-        LIMIT $3 OFFSET $4`, filter.SortColumn(), filter.SortDirection())
+        LIMIT $4 OFFSET $5`, filter.SortColumn(), filter.SortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []any{title, pq.Array(genres), filter.Limit(), filter.Offset()}
+	args := []any{title, pq.Array(genres), pq.Array(tags), filter.Limit(), filter.Offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -200,8 +234,134 @@ func (m MovieModel) GetAll(title string, genres []string, filter filters.Filter)
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
+			&movie.CreatedBy,
+			&movie.UpdatedBy,
+			&movie.CreatedAt,
+			&movie.Version,
+		)
+
+		if err != nil {
+			return nil, filters.ZeroValueMetadata(), err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, filters.ZeroValueMetadata(), err
+	}
+
+	metadata := filters.CalculateMetadata(totalRecords, filter.Page, filter.PageSize)
+
+	return movies, metadata, nil
+}
+
+// GetAllCreatedBy returns the movies the user created, oldest first.
+func (m MovieModel) GetAllCreatedBy(userID int64) ([]*Movie, error) {
+	query := `
+		SELECT id, title, year, runtime, genres, created_by, updated_by, created_at, version
+		FROM movies
+		WHERE created_by = $1
+		ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	movies := make([]*Movie, 0)
+
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(
+			&movie.ID,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.CreatedBy,
+			&movie.UpdatedBy,
+			&movie.CreatedAt,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+func (m MovieModel) GetSimilar(id int64, weights SimilarityWeights, filter filters.Filter) ([]*SimilarMovie, filters.Metadata, error) {
+	query := fmt.Sprintf(`
+        WITH target AS (
+            SELECT genres, year, runtime
+            FROM movies
+            WHERE id = $1
+        )
+        SELECT count(*) OVER(), m.id, m.title, m.year, m.runtime, m.genres, m.created_by, m.updated_by, m.created_at, m.version,
+            $2::float8 * cardinality(ARRAY(SELECT unnest(m.genres) INTERSECT SELECT unnest(t.genres)))
+                / cardinality(ARRAY(SELECT unnest(m.genres) UNION SELECT unnest(t.genres)))
+            + $3::float8 / (1 + abs(m.year - t.year) / 10.0::float8)
+            + $4::float8 / (1 + abs(m.runtime - t.runtime) / 30.0::float8) AS score
+        FROM movies m, target t
+        WHERE m.id <> $1
+        AND m.genres && t.genres
+        ORDER BY %s %s, m.id
+        LIMIT $5 OFFSET $6`, filter.SortColumn(), filter.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{id, weights.Genre, weights.Year, weights.Runtime, filter.Limit(), filter.Offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, filters.ZeroValueMetadata(), err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	totalRecords := 0
+	movies := make([]*SimilarMovie, 0)
+
+	for rows.Next() {
+		movie := SimilarMovie{Movie: &Movie{}}
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.CreatedBy,
+			&movie.UpdatedBy,
 			&movie.CreatedAt,
 			&movie.Version,
+			&movie.Score,
 		)
 
 		if err != nil {
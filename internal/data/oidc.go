@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Identity is an identity provider account linked to a user
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCModel keeps the single sign-on state: the sign ins started with the identity
+// provider, and the provider identities linked to each user.
+type OIDCModel struct {
+	DB *sql.DB
+}
+
+// InsertAuthorization records a sign in started with the provider, which can be completed
+// with its state until ttl passes.
+func (m OIDCModel) InsertAuthorization(state, nonce, verifier string, ttl time.Duration) error {
+	query := `
+        INSERT INTO oidc_authorizations (state_hash, nonce, verifier, expiry)
+        VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, TokenHash(state), nonce, verifier, time.Now().Add(ttl))
+	return err
+}
+
+// TakeAuthorization deletes the sign in started with state, returning its nonce and PKCE
+// verifier. A state can only be used once.
+func (m OIDCModel) TakeAuthorization(state string) (nonce, verifier string, err error) {
+	query := `
+        DELETE FROM oidc_authorizations
+        WHERE state_hash = $1
+        RETURNING nonce, verifier, expiry`
+
+	var expiry time.Time
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, TokenHash(state)).Scan(&nonce, &verifier, &expiry)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", "", ErrRecordNotFound
+		default:
+			return "", "", err
+		}
+	}
+
+	if time.Now().After(expiry) {
+		return "", "", ErrRecordNotFound
+	}
+
+	return nonce, verifier, nil
+}
+
+// DeleteExpiredAuthorizations deletes the sign ins that were never completed.
+func (m OIDCModel) DeleteExpiredAuthorizations() error {
+	query := `
+        DELETE FROM oidc_authorizations
+        WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
+
+// GetUserForIdentity returns the user linked to the subject of the issuer.
+func (m OIDCModel) GetUserForIdentity(issuer, subject string) (*User, error) {
+	query := `
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.service_account, users.totp_enabled, users.version
+        FROM users
+        INNER JOIN user_identities
+        ON users.id = user_identities.user_id
+        WHERE user_identities.issuer = $1
+        AND user_identities.subject = $2`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, issuer, subject).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.ServiceAccount,
+		&user.TwoFactorEnabled,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// LinkIdentity links the subject of the issuer to the user, so later sign ins find the
+// user even if the address at the provider changes.
+func (m OIDCModel) LinkIdentity(userID int64, issuer, subject string) error {
+	query := `
+        INSERT INTO user_identities (issuer, subject, user_id)
+        VALUES ($1, $2, $3)
+        ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, issuer, subject, userID)
+	return err
+}
+
+// GetIdentitiesForUser returns the provider identities linked to the user, oldest first.
+func (m OIDCModel) GetIdentitiesForUser(userID int64) ([]*Identity, error) {
+	query := `
+        SELECT issuer, subject, created_at
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at, issuer, subject`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	identities := make([]*Identity, 0)
+
+	for rows.Next() {
+		var identity Identity
+
+		if err = rows.Scan(&identity.Issuer, &identity.Subject, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, &identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
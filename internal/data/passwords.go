@@ -0,0 +1,167 @@
+package data
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/hvpaiva/greenlight/pkg/bloom"
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+// PasswordPolicy holds the rules a password chosen by a user must follow, on top of the
+// length checks every password goes through. The zero value enforces no extra rule.
+type PasswordPolicy struct {
+	// MinEntropy is the minimum estimated strength of the password, in bits.
+	MinEntropy float64
+	// BanPersonal rejects passwords containing the name or email address of the user.
+	BanPersonal bool
+	// Blocklist holds known compromised passwords, lowercased.
+	Blocklist *bloom.Filter
+}
+
+// Validate checks the password the user is setting against the policy.
+func (p PasswordPolicy) Validate(v *validator.Validator, user *User) {
+	if user.Password.plaintext == nil {
+		return
+	}
+
+	plaintext := *user.Password.plaintext
+	lower := strings.ToLower(plaintext)
+
+	if p.Blocklist != nil {
+		v.Check(!p.Blocklist.Contains(lower), "password", "is a known compromised password")
+	}
+
+	if p.BanPersonal {
+		for _, term := range personalTerms(user) {
+			v.Check(!strings.Contains(lower, term), "password", "must not contain your name or email address")
+		}
+	}
+
+	if p.MinEntropy > 0 {
+		v.Check(PasswordEntropy(plaintext) >= p.MinEntropy, "password", "is too easy to guess, use a longer password or mix more kinds of characters")
+	}
+}
+
+// personalTerms returns the parts of the name and email address of the user that a
+// password must not contain. Very short parts are left out, since they would reject many
+// passwords by chance.
+func personalTerms(user *User) []string {
+	local, _, _ := strings.Cut(strings.ToLower(string(user.Email)), "@")
+
+	fields := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	}
+
+	var terms []string
+
+	for _, term := range append(append(fields(strings.ToLower(user.Name)), fields(local)...), local) {
+		if len(term) >= 3 {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+// PasswordEntropy estimates the strength of the password in bits, as the bits needed to
+// pick each character at random from the kinds of characters it uses. Characters that
+// keep repeating or continuing a sequence (as in "aaaa" or "1234") add nothing.
+func PasswordEntropy(password string) float64 {
+	var (
+		lower, upper, digit, symbol, other bool
+		length                             int
+	)
+
+	runes := []rune(password)
+
+	for i, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+
+		if i >= 2 {
+			step := r - runes[i-1]
+			if step >= -1 && step <= 1 && step == runes[i-1]-runes[i-2] {
+				continue
+			}
+		}
+
+		length++
+	}
+
+	pool := 0
+
+	for _, kind := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if kind.used {
+			pool += kind.size
+		}
+	}
+
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(length) * math.Log2(float64(pool))
+}
+
+// LoadPasswordBlocklist reads the compromised passwords listed one per line in the file at
+// path into a bloom filter with the given false positive rate.
+func LoadPasswordBlocklist(path string, falsePositiveRate float64) (*bloom.Filter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(file *os.File) {
+		_ = file.Close()
+	}(file)
+
+	count := 0
+
+	if err = scanPasswords(file, func(string) { count++ }); err != nil {
+		return nil, err
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	filter := bloom.New(count, falsePositiveRate)
+
+	if err = scanPasswords(file, filter.Add); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func scanPasswords(r io.Reader, fn func(string)) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fn(strings.ToLower(line))
+		}
+	}
+
+	return scanner.Err()
+}
@@ -9,23 +9,56 @@ import (
 	"github.com/lib/pq"
 )
 
+// PermissionsChannel is the channel the database notifies with the ID of the user whose
+// permissions changed, or an empty payload when a role or a permission changed.
+const PermissionsChannel = "permissions_changed"
+
 type Permissions []string
 
 func (p Permissions) Contains(permission string) bool {
 	return slices.Contains(p, permission)
 }
 
+// ContainsAny reports whether any of the permissions is included
+func (p Permissions) ContainsAny(permissions ...string) bool {
+	for _, permission := range permissions {
+		if p.Contains(permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PermissionChange is an entry of the audit log of permission grants and revocations
+type PermissionChange struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ActorID    *int64    `json:"actor_id"`
+	UserID     *int64    `json:"user_id,omitempty"`
+	Action     string    `json:"action"`
+	Permission *string   `json:"permission,omitempty"`
+	Role       *string   `json:"role,omitempty"`
+}
+
 type PermissionModel struct {
 	DB *sql.DB
 }
 
+// GetAllForUser returns the permissions granted to the user directly along with the ones
+// granted through its roles.
 func (m PermissionModel) GetAllForUser(userId int64) (Permissions, error) {
 	query := `
 		SELECT p.code
 		FROM permissions p
 		INNER JOIN users_permissions up ON up.permission_id = p.id
-		INNER JOIN users u ON up.user_id = u.id
-		WHERE u.id = $1
+		WHERE up.user_id = $1
+		UNION
+		SELECT p.code
+		FROM permissions p
+		INNER JOIN roles_permissions rp ON rp.permission_id = p.id
+		INNER JOIN users_roles ur ON ur.role_id = rp.role_id
+		WHERE ur.user_id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -60,17 +93,190 @@ func (m PermissionModel) GetAllForUser(userId int64) (Permissions, error) {
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userId int64, permissions ...string) error {
+func (m PermissionModel) GetAll() (Permissions, error) {
 	query := `
-		INSERT INTO users_permissions
-		SELECT $1, p.id
-		FROM permissions p
-		WHERE p.code = ANY($2)
+		SELECT code
+		FROM permissions
+		ORDER BY code
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, userId, pq.Array(permissions))
-	return err
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	permissions := make(Permissions, 0)
+
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// GrantForUser adds the permissions to the user and records actorID as the one who granted
+// them. It returns the permissions the user was not granted directly before.
+func (m PermissionModel) GrantForUser(actorID, userID int64, permissions ...string) (Permissions, error) {
+	query := `
+		WITH granted AS (
+			INSERT INTO users_permissions
+			SELECT $2, p.id
+			FROM permissions p
+			WHERE p.code = ANY($3)
+			ON CONFLICT DO NOTHING
+			RETURNING permission_id
+		)
+		INSERT INTO permissions_audit (actor_id, user_id, action, permission)
+		SELECT $1, $2, 'grant', p.code
+		FROM granted g
+		INNER JOIN permissions p ON p.id = g.permission_id
+		RETURNING permission
+	`
+
+	return m.change(query, actorID, userID, permissions)
+}
+
+// RemoveForUser removes the permissions granted directly to the user and records actorID
+// as the one who revoked them. It returns the permissions the user actually had; the ones
+// granted through roles are kept.
+func (m PermissionModel) RemoveForUser(actorID, userID int64, permissions ...string) (Permissions, error) {
+	query := `
+		WITH revoked AS (
+			DELETE FROM users_permissions up
+			USING permissions p
+			WHERE up.permission_id = p.id
+			AND up.user_id = $2
+			AND p.code = ANY($3)
+			RETURNING p.code
+		)
+		INSERT INTO permissions_audit (actor_id, user_id, action, permission)
+		SELECT $1, $2, 'revoke', code
+		FROM revoked
+		RETURNING permission
+	`
+
+	return m.change(query, actorID, userID, permissions)
+}
+
+func (m PermissionModel) change(query string, actorID, userID int64, permissions []string) (Permissions, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, actorID, userID, pq.Array(permissions))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	changed := make(Permissions, 0)
+
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		changed = append(changed, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
+
+// GetChangesForUser returns the most recent grants and revocations of the user's
+// permissions, newest first.
+func (m PermissionModel) GetChangesForUser(userID int64, limit int) ([]*PermissionChange, error) {
+	query := `
+		SELECT id, created_at, actor_id, user_id, action, permission, role
+		FROM permissions_audit
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	return m.getChanges(query, userID, limit)
+}
+
+// GetChangesForRole returns the most recent changes to the permissions of the role and its
+// deletion, newest first.
+func (m PermissionModel) GetChangesForRole(name string, limit int) ([]*PermissionChange, error) {
+	query := `
+		SELECT id, created_at, actor_id, user_id, action, permission, role
+		FROM permissions_audit
+		WHERE role = $1 AND user_id IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+
+	return m.getChanges(query, name, limit)
+}
+
+func (m PermissionModel) getChanges(query string, args ...any) ([]*PermissionChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	changes := make([]*PermissionChange, 0)
+
+	for rows.Next() {
+		var change PermissionChange
+
+		err = rows.Scan(
+			&change.ID,
+			&change.CreatedAt,
+			&change.ActorID,
+			&change.UserID,
+			&change.Action,
+			&change.Permission,
+			&change.Role,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
 }
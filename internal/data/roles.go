@@ -0,0 +1,492 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+var (
+	ErrDuplicateRoleName = errors.New("duplicate role name")
+	ErrAdminLockout      = errors.New("change would revoke the admin permission of the actor")
+
+	RoleRX = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+)
+
+// Role is a named set of permissions assigned to users
+type Role struct {
+	ID          int64       `json:"-"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+}
+
+func ValidateRoleName(v *validator.Validator, name string) {
+	v.Check(name != "", "name", "must be provided")
+	v.Check(len(name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(name, RoleRX), "name", "must only contain lowercase letters, numbers and hyphens")
+}
+
+func (r *Role) Validate(v *validator.Validator) {
+	ValidateRoleName(v, r.Name)
+
+	v.Check(len(r.Description) <= 500, "description", "must not be more than 500 bytes long")
+	v.Check(validator.Unique(r.Permissions), "permissions", "must not contain duplicate values")
+}
+
+type RoleModel struct {
+	DB *sql.DB
+}
+
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+        SELECT r.id, r.created_at, r.name, r.description,
+            COALESCE(array_agg(p.code ORDER BY p.code) FILTER (WHERE p.code IS NOT NULL), '{}')
+        FROM roles r
+        LEFT JOIN roles_permissions rp ON rp.role_id = r.id
+        LEFT JOIN permissions p ON p.id = rp.permission_id
+        GROUP BY r.id
+        ORDER BY r.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	roles := make([]*Role, 0)
+
+	for rows.Next() {
+		var role Role
+
+		err = rows.Scan(
+			&role.ID,
+			&role.CreatedAt,
+			&role.Name,
+			&role.Description,
+			pq.Array(&role.Permissions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (m RoleModel) GetByName(name string) (*Role, error) {
+	query := `
+        SELECT r.id, r.created_at, r.name, r.description,
+            COALESCE(array_agg(p.code ORDER BY p.code) FILTER (WHERE p.code IS NOT NULL), '{}')
+        FROM roles r
+        LEFT JOIN roles_permissions rp ON rp.role_id = r.id
+        LEFT JOIN permissions p ON p.id = rp.permission_id
+        WHERE r.name = $1
+        GROUP BY r.id`
+
+	var role Role
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(
+		&role.ID,
+		&role.CreatedAt,
+		&role.Name,
+		&role.Description,
+		pq.Array(&role.Permissions),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &role, nil
+}
+
+func (m RoleModel) Insert(role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	query := `
+        INSERT INTO roles (name, description)
+        VALUES ($1, $2)
+        RETURNING id, created_at`
+
+	err = tx.QueryRowContext(ctx, query, role.Name, role.Description).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return ErrDuplicateRoleName
+		default:
+			return err
+		}
+	}
+
+	if err = setRolePermissions(ctx, tx, role); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Update replaces the description and the permissions of the role, and records actorID as
+// the one who granted or revoked the permissions that changed. It fails with
+// ErrAdminLockout when the actor would lose the permission to administer users.
+func (m RoleModel) Update(actorID int64, role *Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	res, err := tx.ExecContext(ctx, `UPDATE roles SET description = $1 WHERE id = $2`, role.Description, role.ID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+        WITH revoked AS (
+            DELETE FROM roles_permissions rp
+            USING permissions p
+            WHERE rp.permission_id = p.id
+            AND rp.role_id = $2
+            AND p.code <> ALL($4)
+            RETURNING p.code
+        ), granted AS (
+            INSERT INTO roles_permissions (role_id, permission_id)
+            SELECT $2, p.id
+            FROM permissions p
+            WHERE p.code = ANY($4)
+            ON CONFLICT DO NOTHING
+            RETURNING permission_id
+        )
+        INSERT INTO permissions_audit (actor_id, action, role, permission)
+        SELECT $1, 'revoke', $3, code
+        FROM revoked
+        UNION ALL
+        SELECT $1, 'grant', $3, p.code
+        FROM granted g
+        INNER JOIN permissions p ON p.id = g.permission_id`
+
+	_, err = tx.ExecContext(ctx, query, actorID, role.ID, role.Name, pq.Array(role.Permissions))
+	if err != nil {
+		return err
+	}
+
+	if err = checkKeepsAdmin(ctx, tx, actorID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkKeepsAdmin fails with ErrAdminLockout when, once the changes made in the
+// transaction apply, the actor no longer holds the permission to administer users. Since
+// the actor held it to make the changes, passing the check also means someone still does.
+// Concurrent checks are serialized, so two admins cannot each remove the other's access.
+func checkKeepsAdmin(ctx context.Context, tx *sql.Tx, actorID int64) error {
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('users:admin'))`); err != nil {
+		return err
+	}
+
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM users_permissions up
+            INNER JOIN permissions p ON p.id = up.permission_id
+            WHERE up.user_id = $1 AND p.code = $2
+            UNION ALL
+            SELECT 1
+            FROM users_roles ur
+            INNER JOIN roles_permissions rp ON rp.role_id = ur.role_id
+            INNER JOIN permissions p ON p.id = rp.permission_id
+            WHERE ur.user_id = $1 AND p.code = $2
+        )`
+
+	var admin bool
+
+	if err := tx.QueryRowContext(ctx, query, actorID, PermissionUsersAdmin).Scan(&admin); err != nil {
+		return err
+	}
+
+	if !admin {
+		return ErrAdminLockout
+	}
+
+	return nil
+}
+
+func setRolePermissions(ctx context.Context, db execer, role *Role) error {
+	query := `
+        INSERT INTO roles_permissions (role_id, permission_id)
+        SELECT $1, p.id
+        FROM permissions p
+        WHERE p.code = ANY($2)`
+
+	_, err := db.ExecContext(ctx, query, role.ID, pq.Array(role.Permissions))
+	return err
+}
+
+// Delete deletes the role and records actorID as the one who deleted it, and who
+// unassigned it from the users who had it. It fails with ErrAdminLockout when the actor
+// would lose the permission to administer users.
+func (m RoleModel) Delete(actorID int64, name string) error {
+	query := `
+        WITH deleted AS (
+            DELETE FROM roles
+            WHERE name = $2
+            RETURNING id
+        ), unassigned AS (
+            INSERT INTO permissions_audit (actor_id, user_id, action, role)
+            SELECT $1, ur.user_id, 'unassign', $2
+            FROM users_roles ur
+            INNER JOIN deleted d ON d.id = ur.role_id
+        )
+        INSERT INTO permissions_audit (actor_id, action, role)
+        SELECT $1, 'delete', $2
+        FROM deleted`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	res, err := tx.ExecContext(ctx, query, actorID, name)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	if err = checkKeepsAdmin(ctx, tx, actorID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+        SELECT r.name
+        FROM roles r
+        INNER JOIN users_roles ur ON ur.role_id = r.id
+        WHERE ur.user_id = $1
+        ORDER BY r.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	roles := make([]string, 0)
+
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AddForUser assigns the role to the user, as done on registration. It returns
+// ErrRecordNotFound when there is no role with the name.
+func (m RoleModel) AddForUser(userID int64, name string) error {
+	query := `
+        WITH role AS (
+            SELECT id
+            FROM roles
+            WHERE name = $2
+        ), assigned AS (
+            INSERT INTO users_roles (user_id, role_id)
+            SELECT $1, id
+            FROM role
+            ON CONFLICT DO NOTHING
+        )
+        SELECT id
+        FROM role`
+
+	var roleID int64
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, name).Scan(&roleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AssignToUser assigns the role to the user and records actorID as the one who assigned
+// it. It reports whether the user did not have the role yet.
+func (m RoleModel) AssignToUser(actorID, userID int64, name string) (bool, error) {
+	query := `
+        WITH assigned AS (
+            INSERT INTO users_roles (user_id, role_id)
+            SELECT $2, r.id
+            FROM roles r
+            WHERE r.name = $3
+            ON CONFLICT DO NOTHING
+            RETURNING role_id
+        )
+        INSERT INTO permissions_audit (actor_id, user_id, action, role)
+        SELECT $1, $2, 'assign', $3
+        FROM assigned`
+
+	return m.change(query, actorID, userID, name)
+}
+
+// RemoveFromUser removes the role from the user and records actorID as the one who
+// removed it. It reports whether the user had the role, and fails with ErrAdminLockout
+// when the actor would lose the permission to administer users.
+func (m RoleModel) RemoveFromUser(actorID, userID int64, name string) (bool, error) {
+	query := `
+        WITH removed AS (
+            DELETE FROM users_roles ur
+            USING roles r
+            WHERE ur.role_id = r.id
+            AND ur.user_id = $2
+            AND r.name = $3
+            RETURNING ur.role_id
+        )
+        INSERT INTO permissions_audit (actor_id, user_id, action, role)
+        SELECT $1, $2, 'unassign', $3
+        FROM removed`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	res, err := tx.ExecContext(ctx, query, actorID, userID, name)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if rows == 0 {
+		return false, nil
+	}
+
+	if err = checkKeepsAdmin(ctx, tx, actorID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (m RoleModel) change(query string, actorID, userID int64, name string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, actorID, userID, name)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type StatCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+type RuntimePercentiles struct {
+	P25 float64 `json:"p25"`
+	P50 float64 `json:"p50"`
+	P75 float64 `json:"p75"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+type MovieStats struct {
+	Total         int                `json:"total"`
+	Genres        []StatCount        `json:"genres"`
+	Decades       []StatCount        `json:"decades"`
+	Years         []StatCount        `json:"years"`
+	Runtime       RuntimePercentiles `json:"runtime"`
+	CreatedPerDay []StatCount        `json:"created_per_day"`
+}
+
+type StatsModel struct {
+	DB *sql.DB
+}
+
+const statsFilter = `
+        (to_tsvector('simple', m.title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+        AND (m.genres @> $2 OR $2 = '{}')`
+
+func (s StatsModel) GetMovieStats(title string, genres []string, from, to time.Time) (*MovieStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	filterArgs := []any{title, pq.Array(genres)}
+
+	var stats MovieStats
+
+	var percentiles []float64
+
+	err = tx.QueryRowContext(ctx, `
+        SELECT count(*), coalesce(percentile_cont(ARRAY[0.25, 0.5, 0.75, 0.9, 0.99]) WITHIN GROUP (ORDER BY m.runtime), '{}')
+        FROM movies m
+        WHERE`+statsFilter, filterArgs...).Scan(&stats.Total, pq.Array(&percentiles))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(percentiles) == 5 {
+		stats.Runtime = RuntimePercentiles{
+			P25: percentiles[0],
+			P50: percentiles[1],
+			P75: percentiles[2],
+			P90: percentiles[3],
+			P99: percentiles[4],
+		}
+	}
+
+	if stats.Genres, err = queryCounts(ctx, tx, `
+        SELECT g, count(*)
+        FROM movies m, unnest(m.genres) g
+        WHERE`+statsFilter+`
+        GROUP BY g
+        ORDER BY count(*) DESC, g`, filterArgs...); err != nil {
+		return nil, err
+	}
+
+	if stats.Decades, err = queryCounts(ctx, tx, `
+        SELECT (m.year / 10 * 10)::text, count(*)
+        FROM movies m
+        WHERE`+statsFilter+`
+        GROUP BY m.year / 10
+        ORDER BY m.year / 10`, filterArgs...); err != nil {
+		return nil, err
+	}
+
+	if stats.Years, err = queryCounts(ctx, tx, `
+        SELECT m.year::text, count(*)
+        FROM movies m
+        WHERE`+statsFilter+`
+        GROUP BY m.year
+        ORDER BY m.year`, filterArgs...); err != nil {
+		return nil, err
+	}
+
+	if stats.CreatedPerDay, err = queryCounts(ctx, tx, `
+        SELECT to_char(d, 'YYYY-MM-DD'), count(m.id)
+        FROM generate_series($3::date, $4::date, interval '1 day') d
+        LEFT JOIN movies m ON m.created_at::date = d::date AND`+statsFilter+`
+        GROUP BY d
+        ORDER BY d`, append(filterArgs, from, to)...); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func queryCounts(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]StatCount, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	counts := make([]StatCount, 0)
+
+	for rows.Next() {
+		var count StatCount
+		if err = rows.Scan(&count.Key, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
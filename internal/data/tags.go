@@ -0,0 +1,320 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+var (
+	TagRX = regexp.MustCompile(`^[\p{L}\p{N}]+(?:[ -][\p{L}\p{N}]+)*$`)
+)
+
+type Tag struct {
+	ID        int64     `json:"-"`
+	CreatedAt time.Time `json:"-"`
+	Name      string    `json:"name"`
+	Banned    bool      `json:"banned"`
+}
+
+type MovieTag struct {
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+	Votes int    `json:"votes"`
+}
+
+// TagVote is a vote a user cast on a tag of a movie
+type TagVote struct {
+	MovieID   int64     `json:"movie_id"`
+	Tag       string    `json:"tag"`
+	Vote      int       `json:"vote"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TagSuggestion struct {
+	Name   string `json:"name"`
+	Movies int    `json:"movies"`
+}
+
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+func ValidateTag(v *validator.Validator, tag string) {
+	v.Check(tag != "", "tag", "must be provided")
+	v.Check(len(tag) <= 50, "tag", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(tag, TagRX), "tag", "must only contain letters, numbers, single spaces and hyphens")
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+func (m TagModel) Upsert(name string) (*Tag, error) {
+	query := `
+        INSERT INTO tags (name)
+        VALUES ($1)
+        ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+        RETURNING id, created_at, name, banned`
+
+	var tag Tag
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(&tag.ID, &tag.CreatedAt, &tag.Name, &tag.Banned)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
+
+func (m TagModel) GetByName(name string) (*Tag, error) {
+	query := `
+        SELECT id, created_at, name, banned
+        FROM tags
+        WHERE name = $1`
+
+	var tag Tag
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, name).Scan(&tag.ID, &tag.CreatedAt, &tag.Name, &tag.Banned)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tag, nil
+}
+
+// SetBanned bans or unbans a tag across the system. Banning a tag that does not exist
+// yet creates it, so it can be blocked before anyone uses it.
+func (m TagModel) SetBanned(name string, banned bool) (*Tag, error) {
+	query := `
+        INSERT INTO tags (name, banned)
+        VALUES ($1, $2)
+        ON CONFLICT (name) DO UPDATE SET banned = EXCLUDED.banned
+        RETURNING id, created_at, name, banned`
+
+	if !banned {
+		query = `
+            UPDATE tags
+            SET banned = $2
+            WHERE name = $1
+            RETURNING id, created_at, name, banned`
+	}
+
+	var tag Tag
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, name, banned).Scan(&tag.ID, &tag.CreatedAt, &tag.Name, &tag.Banned)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tag, nil
+}
+
+func (m TagModel) Vote(movieID, tagID, userID int64, vote int) error {
+	query := `
+        INSERT INTO movies_tags (movie_id, tag_id, user_id, vote)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (movie_id, tag_id, user_id) DO UPDATE SET vote = EXCLUDED.vote`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, movieID, tagID, userID, vote)
+	return err
+}
+
+func (m TagModel) RemoveVote(movieID, tagID, userID int64) error {
+	query := `
+        DELETE FROM movies_tags
+        WHERE movie_id = $1 AND tag_id = $2 AND user_id = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, movieID, tagID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m TagModel) IsOnMovie(movieID, tagID int64) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM movies_tags
+            WHERE movie_id = $1 AND tag_id = $2
+        )`
+
+	var exists bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, tagID).Scan(&exists)
+	return exists, err
+}
+
+func (m TagModel) GetAllForMovie(movieID int64) ([]*MovieTag, error) {
+	query := `
+        SELECT t.name, sum(mt.vote), count(*)
+        FROM movies_tags mt
+        INNER JOIN tags t ON t.id = mt.tag_id
+        WHERE mt.movie_id = $1
+        AND NOT t.banned
+        GROUP BY t.name
+        ORDER BY sum(mt.vote) DESC, t.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	tags := make([]*MovieTag, 0)
+
+	for rows.Next() {
+		var tag MovieTag
+		if err = rows.Scan(&tag.Name, &tag.Score, &tag.Votes); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Search returns the non-banned tags starting with prefix, most used first.
+func (m TagModel) Search(prefix string, limit int) ([]*TagSuggestion, error) {
+	query := `
+        SELECT t.name, count(DISTINCT mt.movie_id)
+        FROM tags t
+        INNER JOIN movies_tags mt ON mt.tag_id = t.id
+        WHERE t.name LIKE $1 ESCAPE '\'
+        AND NOT t.banned
+        GROUP BY t.name
+        ORDER BY count(DISTINCT mt.movie_id) DESC, t.name
+        LIMIT $2`
+
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	suggestions := make([]*TagSuggestion, 0)
+
+	for rows.Next() {
+		var suggestion TagSuggestion
+		if err = rows.Scan(&suggestion.Name, &suggestion.Movies); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+func (m TagModel) GetVotesForUser(userID int64) ([]*TagVote, error) {
+	query := `
+        SELECT mt.movie_id, t.name, mt.vote, mt.created_at
+        FROM movies_tags mt
+        INNER JOIN tags t ON t.id = mt.tag_id
+        WHERE mt.user_id = $1
+        ORDER BY mt.created_at, mt.movie_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	votes := make([]*TagVote, 0)
+
+	for rows.Next() {
+		var vote TagVote
+
+		if err = rows.Scan(&vote.MovieID, &vote.Tag, &vote.Vote, &vote.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		votes = append(votes, &vote)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return votes, nil
+}
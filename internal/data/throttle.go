@@ -0,0 +1,177 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+// LoginThrottle tracks the failed logins of an account, keyed by its email address, or of
+// a client IP.
+type LoginThrottle struct {
+	Kind          string     `json:"kind"`
+	Subject       string     `json:"subject"`
+	UserID        *int64     `json:"user_id,omitempty"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	BlockedUntil  *time.Time `json:"blocked_until"`
+}
+
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+// BlockedUntil returns until when logins for the account or from the IP are blocked, or
+// the zero time when neither is.
+func (m LoginThrottleModel) BlockedUntil(account, ip string) (time.Time, error) {
+	query := `
+        SELECT MAX(blocked_until)
+        FROM login_throttles
+        WHERE ((kind = $1 AND subject = $2) OR (kind = $3 AND subject = $4))
+        AND blocked_until > NOW()`
+
+	var until sql.NullTime
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, ThrottleAccount, account, ThrottleIP, ip).Scan(&until)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return until.Time, nil
+}
+
+// RecordFailure counts a failed login and returns the failures in a row so far. Failures
+// older than window are forgotten.
+func (m LoginThrottleModel) RecordFailure(kind, subject string, window time.Duration) (int, error) {
+	query := `
+        INSERT INTO login_throttles (kind, subject, failures, last_failure_at)
+        VALUES ($1, $2, 1, NOW())
+        ON CONFLICT (kind, subject) DO UPDATE
+        SET failures = CASE
+                WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+                ELSE login_throttles.failures + 1
+            END,
+            last_failure_at = NOW()
+        RETURNING failures`
+
+	var failures int
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, kind, subject, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+func (m LoginThrottleModel) Block(kind, subject string, until time.Time) error {
+	query := `
+        UPDATE login_throttles
+        SET blocked_until = $1
+        WHERE kind = $2 AND subject = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, until, kind, subject)
+	return err
+}
+
+// Reset forgets the failures of the subject, lifting any block on it.
+func (m LoginThrottleModel) Reset(kind, subject string) error {
+	query := `
+        DELETE FROM login_throttles
+        WHERE kind = $1 AND subject = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, kind, subject)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllBlocked returns the accounts and IPs currently blocked, with the user behind each
+// blocked account when there is one.
+func (m LoginThrottleModel) GetAllBlocked() ([]*LoginThrottle, error) {
+	query := `
+        SELECT t.kind, t.subject, u.id, t.failures, t.last_failure_at, t.blocked_until
+        FROM login_throttles t
+        LEFT JOIN users u ON t.kind = $1 AND u.email = t.subject::citext
+        WHERE t.blocked_until > NOW()
+        ORDER BY t.blocked_until DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ThrottleAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	throttles := make([]*LoginThrottle, 0)
+
+	for rows.Next() {
+		var throttle LoginThrottle
+
+		err = rows.Scan(
+			&throttle.Kind,
+			&throttle.Subject,
+			&throttle.UserID,
+			&throttle.Failures,
+			&throttle.LastFailureAt,
+			&throttle.BlockedUntil,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		throttles = append(throttles, &throttle)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return throttles, nil
+}
+
+// DeleteStale removes the subjects without failures within window that are not blocked.
+func (m LoginThrottleModel) DeleteStale(window time.Duration) error {
+	query := `
+        DELETE FROM login_throttles
+        WHERE last_failure_at < NOW() - make_interval(secs => $1)
+        AND (blocked_until IS NULL OR blocked_until <= NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, window.Seconds())
+	return err
+}
@@ -6,14 +6,25 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/hvpaiva/greenlight/pkg/validator"
 )
 
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeTwoFactor      = "2fa-challenge"
+	ScopeEmailChange    = "email-change"
+)
+
+var (
+	ErrTokenReused = errors.New("token reused")
 )
 
 type Token struct {
@@ -22,6 +33,26 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+	Family    []byte    `json:"-"`
+}
+
+type TokenPair struct {
+	UserID       int64  `json:"-"`
+	Family       []byte `json:"-"`
+	AccessToken  *Token `json:"access_token"`
+	RefreshToken *Token `json:"refresh_token"`
+}
+
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Expiry     time.Time  `json:"expiry"`
+	Current    bool       `json:"current"`
 }
 
 func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error) {
@@ -39,12 +70,16 @@ func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error
 
 	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
 
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	token.Hash = TokenHash(token.Plaintext)
 
 	return token, nil
 }
 
+func TokenHash(tokenPlaintext string) []byte {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	return hash[:]
+}
+
 func ValidateToken(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
@@ -68,18 +103,152 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
-func (m TokenModel) Insert(token *Token) error {
+// NewSession issues an access token and a refresh token belonging to a new token family. A
+// zero accessTTL only issues the refresh token, for when access tokens are stateless JWTs.
+func (m TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*TokenPair, error) {
+	family := make([]byte, 16)
+
+	if _, err := rand.Read(family); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	pair, err := insertPair(ctx, tx, userID, family, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, tx.Commit()
+}
+
+// Rotate exchanges a refresh token for a new token pair in the same family. Presenting a
+// refresh token that was already rotated revokes the whole family and returns ErrTokenReused.
+func (m TokenModel) Rotate(refreshPlaintext string, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*TokenPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
 	query := `
-        INSERT INTO tokens (hash, user_id, expiry, scope) 
-        VALUES ($1, $2, $3, $4)
-	`
+        SELECT user_id, family, used_at IS NOT NULL
+        FROM tokens
+        WHERE hash = $1
+        AND scope = $2
+        AND expiry > $3
+        FOR UPDATE`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	var (
+		userID int64
+		family []byte
+		used   bool
+	)
+
+	err = tx.QueryRowContext(ctx, query, TokenHash(refreshPlaintext), ScopeRefresh, time.Now()).Scan(&userID, &family, &used)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
 
+	if used {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, family); err != nil {
+			return nil, err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrTokenReused
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE tokens SET used_at = NOW() WHERE hash = $1`, TokenHash(refreshPlaintext)); err != nil {
+		return nil, err
+	}
+
+	pair, err := insertPair(ctx, tx, userID, family, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	return pair, tx.Commit()
+}
+
+func insertPair(ctx context.Context, tx *sql.Tx, userID int64, family []byte, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*TokenPair, error) {
+	pair := &TokenPair{UserID: userID, Family: family}
+
+	for _, t := range []struct {
+		dst   **Token
+		ttl   time.Duration
+		scope string
+	}{
+		{&pair.AccessToken, accessTTL, ScopeAuthentication},
+		{&pair.RefreshToken, refreshTTL, ScopeRefresh},
+	} {
+		if t.ttl <= 0 {
+			continue
+		}
+
+		token, err := generateToken(userID, t.ttl, t.scope)
+		if err != nil {
+			return nil, err
+		}
+
+		token.IP = ip
+		token.UserAgent = userAgent
+		token.Family = family
+
+		if err = insertToken(ctx, tx, token); err != nil {
+			return nil, err
+		}
+
+		*t.dst = token
+	}
+
+	return pair, nil
+}
+
+func (m TokenModel) Insert(token *Token) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	return insertToken(ctx, m.DB, token)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertToken(ctx context.Context, db execer, token *Token) error {
+	query := `
+        INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent, family) 
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.Family}
+
+	_, err := db.ExecContext(ctx, query, args...)
 	return err
 }
 
@@ -95,3 +264,219 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteByHash deletes the token with the given hash along with every other token of its family.
+func (m TokenModel) DeleteByHash(hash []byte) error {
+	query := `
+        DELETE FROM tokens
+        WHERE hash = $1
+        OR family = (SELECT family FROM tokens WHERE hash = $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, hash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m TokenModel) DeleteFamily(family []byte) error {
+	query := `
+        DELETE FROM tokens
+        WHERE family = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, family)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m TokenModel) DeleteAllSessionsForUser(userID int64) error {
+	query := `
+        DELETE FROM tokens
+        WHERE user_id = $1 AND scope = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array([]string{ScopeAuthentication, ScopeRefresh}))
+	return err
+}
+
+// DeleteOtherSessionsForUser deletes every session of the user but the one of the given
+// family. A nil family deletes them all.
+func (m TokenModel) DeleteOtherSessionsForUser(userID int64, family []byte) error {
+	query := `
+        DELETE FROM tokens
+        WHERE user_id = $1 AND scope = ANY($2)
+        AND ($3::bytea IS NULL OR family IS DISTINCT FROM $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array([]string{ScopeAuthentication, ScopeRefresh}), family)
+	return err
+}
+
+// GetFamily returns the family of the token with the given hash, which is nil for tokens
+// issued outside a session.
+func (m TokenModel) GetFamily(hash []byte) ([]byte, error) {
+	query := `
+        SELECT family
+        FROM tokens
+        WHERE hash = $1`
+
+	var family []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash).Scan(&family)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return family, nil
+}
+
+func (m TokenModel) DeleteAllScopesForUser(userID int64) error {
+	query := `
+        DELETE FROM tokens
+        WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Touch records that the token was used, writing at most once per interval.
+func (m TokenModel) Touch(hash []byte, interval time.Duration) error {
+	query := `
+        UPDATE tokens
+        SET last_used_at = NOW()
+        WHERE hash = $1
+        AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, hash, interval.Seconds())
+	return err
+}
+
+// GetSessionsForUser lists the live token families of the user, one per login, represented
+// by their current refresh token.
+func (m TokenModel) GetSessionsForUser(userID int64, currentHash []byte) ([]*Session, error) {
+	query := `
+        SELECT t.id,
+            (SELECT min(f.created_at) FROM tokens f WHERE f.family = t.family),
+            (SELECT max(f.last_used_at) FROM tokens f WHERE f.family = t.family),
+            t.ip, t.user_agent, t.expiry,
+            coalesce(t.family = (SELECT c.family FROM tokens c WHERE c.hash = $2), false)
+        FROM tokens t
+        WHERE t.user_id = $1
+        AND t.scope = $3
+        AND t.used_at IS NULL
+        AND t.expiry > NOW()
+        ORDER BY 3 DESC NULLS LAST, t.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, currentHash, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	sessions := make([]*Session, 0)
+
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.IP,
+			&session.UserAgent,
+			&session.Expiry,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession revokes the token family of the session with the given id.
+func (m TokenModel) DeleteSession(userID, sessionID int64) error {
+	query := `
+        DELETE FROM tokens
+        WHERE user_id = $2
+        AND family = (SELECT family FROM tokens WHERE id = $1 AND user_id = $2 AND scope = $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, sessionID, userID, ScopeRefresh)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
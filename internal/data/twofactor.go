@@ -0,0 +1,296 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/hvpaiva/greenlight/pkg/validator"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorNotPending = errors.New("two-factor enrolment not pending")
+	ErrCodeReused          = errors.New("code reused")
+)
+
+// GenerateRecoveryCodes returns a fresh set of single-use recovery codes, formatted as
+// two groups of five lowercase base32 characters.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		randomBytes := make([]byte, 10)
+
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(randomBytes))
+		codes[i] = code[:5] + "-" + code[5:10]
+	}
+
+	return codes, nil
+}
+
+// NormalizeRecoveryCode lowercases the code and drops whitespace, so codes can be typed
+// back the way they are printed.
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.Join(strings.Fields(code), ""))
+}
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 6, "code", "must be 6 digits long")
+}
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+// SetPending stores a new secret for the user, replacing any enrolment not yet confirmed.
+func (m TwoFactorModel) SetPending(userID int64, secret string) error {
+	query := `
+        UPDATE users
+        SET totp_secret = $1
+        WHERE id = $2 AND NOT totp_enabled`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// GetSecret returns the secret of the user, if an enrolment was started.
+func (m TwoFactorModel) GetSecret(userID int64) (string, error) {
+	query := `
+        SELECT totp_secret
+        FROM users
+        WHERE id = $1 AND totp_secret IS NOT NULL`
+
+	var secret string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return secret, nil
+}
+
+// Enable confirms the pending enrolment of the user and replaces its recovery codes.
+func (m TwoFactorModel) Enable(userID int64, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	query := `
+        UPDATE users
+        SET totp_enabled = true
+        WHERE id = $1 AND totp_secret IS NOT NULL AND NOT totp_enabled`
+
+	res, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrTwoFactorNotPending
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES ($1, $2)`, userID, TokenHash(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Disable removes the secret and the recovery codes of the user.
+func (m TwoFactorModel) Disable(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	query := `
+        UPDATE users
+        SET totp_secret = NULL, totp_enabled = false, totp_last_step = 0
+        WHERE id = $1`
+
+	if _, err = tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records the time step of an accepted code, so the same code cannot be
+// accepted twice.
+func (m TwoFactorModel) UseStep(userID int64, step int64) error {
+	query := `
+        UPDATE users
+        SET totp_last_step = $1
+        WHERE id = $2 AND totp_last_step < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrCodeReused
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes the recovery code, if the user has it and it was not used yet.
+func (m TwoFactorModel) UseRecoveryCode(userID int64, code string) error {
+	query := `
+        UPDATE recovery_codes
+        SET used_at = NOW()
+        WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, TokenHash(code))
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SetRequiredForPermissions sets whether holding any of the permissions requires the user
+// to use two-factor authentication.
+func (m TwoFactorModel) SetRequiredForPermissions(codes []string, required bool) error {
+	query := `
+        UPDATE permissions
+        SET totp_required = $1
+        WHERE code = ANY($2) AND totp_required <> $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, required, pq.Array(codes))
+	return err
+}
+
+// GetRequiredPermissions returns the permissions whose holders must use two-factor
+// authentication.
+func (m TwoFactorModel) GetRequiredPermissions() (Permissions, error) {
+	query := `
+        SELECT code
+        FROM permissions
+        WHERE totp_required
+        ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
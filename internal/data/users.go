@@ -2,13 +2,18 @@ package data
 
 import (
 	"context"
-	"crypto/sha256"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/hvpaiva/greenlight/pkg/filters"
 	"github.com/hvpaiva/greenlight/pkg/validator"
 )
 
@@ -21,13 +26,16 @@ var AnonymousUser = &User{}
 type Email string
 
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     Email     `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID               int64     `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	Name             string    `json:"name"`
+	Email            Email     `json:"email"`
+	Password         password  `json:"-"`
+	Activated        bool      `json:"activated"`
+	Suspended        bool      `json:"suspended"`
+	ServiceAccount   bool      `json:"service_account"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	Version          int       `json:"-"`
 }
 
 type password struct {
@@ -51,7 +59,23 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// SetRandom replaces the password with a random one nobody knows, so the account can
+// only be recovered through a password reset.
+func (p *password) SetRandom() error {
+	randomBytes := make([]byte, 32)
+
+	if _, err := rand.Read(randomBytes); err != nil {
+		return err
+	}
+
+	return p.Set(base64.RawURLEncoding.EncodeToString(randomBytes))
+}
+
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if p.hash == nil {
+		return false, nil
+	}
+
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
 		switch {
@@ -86,7 +110,7 @@ func (u *User) Validate(v *validator.Validator) {
 		u.Password.Validate(v)
 	}
 
-	if u.Password.hash == nil {
+	if u.Password.hash == nil && !u.ServiceAccount {
 		panic("missing password hash for user")
 	}
 }
@@ -97,11 +121,11 @@ type UserModel struct {
 
 func (m UserModel) Insert(user *User) error {
 	query := `
-        INSERT INTO users (name, email, password_hash, activated) 
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO users (name, email, password_hash, activated, service_account) 
+        VALUES ($1, $2, $3, $4, $5)
         RETURNING id, created_at, version`
 
-	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.ServiceAccount}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -122,9 +146,49 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+        SELECT id, created_at, name, email, password_hash, activated, suspended, service_account, totp_enabled, version
+        FROM users
+        WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Suspended,
+		&user.ServiceAccount,
+		&user.TwoFactorEnabled,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-        SELECT id, created_at, name, email, password_hash, activated, version
+        SELECT id, created_at, name, email, password_hash, activated, suspended, service_account, totp_enabled, version
         FROM users
         WHERE email = $1`
 
@@ -140,6 +204,9 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Suspended,
+		&user.ServiceAccount,
+		&user.TwoFactorEnabled,
 		&user.Version,
 	)
 
@@ -155,11 +222,73 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// GetAll returns the users whose email address and name contain the given terms, ignoring
+// case. Empty terms match every user.
+func (m UserModel) GetAll(email, name string, filter filters.Filter) ([]*User, filters.Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, name, email, activated, suspended, service_account, totp_enabled, version
+        FROM users
+        WHERE (strpos(lower(email), lower($1)) > 0 OR $1 = '')
+        AND (strpos(lower(name), lower($2)) > 0 OR $2 = '')
+        ORDER BY %s %s, id
+        LIMIT $3 OFFSET $4`, filter.SortColumn(), filter.SortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{email, name, filter.Limit(), filter.Offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, filters.ZeroValueMetadata(), err
+	}
+
+	defer func(rows *sql.Rows) {
+		err = rows.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(rows)
+
+	totalRecords := 0
+	users := make([]*User, 0)
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Activated,
+			&user.Suspended,
+			&user.ServiceAccount,
+			&user.TwoFactorEnabled,
+			&user.Version,
+		)
+
+		if err != nil {
+			return nil, filters.ZeroValueMetadata(), err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, filters.ZeroValueMetadata(), err
+	}
+
+	metadata := filters.CalculateMetadata(totalRecords, filter.Page, filter.PageSize)
+
+	return users, metadata, nil
+}
+
 func (m UserModel) Update(user *User) error {
 	query := `
         UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, suspended = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version`
 
 	args := []any{
@@ -167,6 +296,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Suspended,
 		user.ID,
 		user.Version,
 	}
@@ -190,10 +320,10 @@ func (m UserModel) Update(user *User) error {
 }
 
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
-	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	tokenHash := TokenHash(tokenPlaintext)
 
 	query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.suspended, users.service_account, users.totp_enabled, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -201,7 +331,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
         AND tokens.scope = $2 
         AND tokens.expiry > $3`
 
-	args := []any{tokenHash[:], tokenScope, time.Now()}
+	args := []any{tokenHash, tokenScope, time.Now()}
 
 	var user User
 
@@ -215,6 +345,9 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Suspended,
+		&user.ServiceAccount,
+		&user.TwoFactorEnabled,
 		&user.Version,
 	)
 	if err != nil {
@@ -228,3 +361,183 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	return &user, nil
 }
+
+// ScheduleDeletion marks the user to be deleted once at is reached.
+func (m UserModel) ScheduleDeletion(id int64, at time.Time) error {
+	query := `
+        UPDATE users
+        SET delete_after = $1
+        WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, at, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CancelDeletion clears the scheduled deletion of the user, returning ErrRecordNotFound
+// when none was scheduled.
+func (m UserModel) CancelDeletion(id int64) error {
+	query := `
+        UPDATE users
+        SET delete_after = NULL
+        WHERE id = $1 AND delete_after IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetDeleteAfter returns when the user is scheduled to be deleted, or nil if not.
+func (m UserModel) GetDeleteAfter(id int64) (*time.Time, error) {
+	query := `
+        SELECT delete_after
+        FROM users
+        WHERE id = $1`
+
+	var at *time.Time
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&at)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return at, nil
+}
+
+// IsSuspended reports whether the user is suspended.
+func (m UserModel) IsSuspended(id int64) (bool, error) {
+	query := `
+        SELECT suspended
+        FROM users
+        WHERE id = $1`
+
+	var suspended bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&suspended)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+
+	return suspended, nil
+}
+
+// DeleteScheduled deletes the users whose grace period is over. Most of their data goes
+// with them through ON DELETE CASCADE; the rest, which is not tied to the users table by
+// a foreign key, is deleted explicitly. It returns how many users were deleted.
+func (m UserModel) DeleteScheduled() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer func(tx *sql.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+
+	query := `
+        DELETE FROM users
+        WHERE delete_after <= NOW()
+        RETURNING id, email`
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		ids    []int64
+		emails []string
+	)
+
+	for rows.Next() {
+		var (
+			id    int64
+			email string
+		)
+
+		if err = rows.Scan(&id, &email); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+
+		ids = append(ids, id)
+		emails = append(emails, strings.ToLower(email))
+	}
+
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM login_throttles WHERE kind = $1 AND subject = ANY($2)`, ThrottleAccount, pq.Array(emails))
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(ids)), nil
+}
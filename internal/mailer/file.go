@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// FileSender writes messages to .eml files in Dir, or to Out when Dir is empty.
+// It is meant for development and tests.
+type FileSender struct {
+	Dir string
+	Out io.Writer
+
+	mu sync.Mutex
+}
+
+func (s *FileSender) Send(msg *Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Dir == "" {
+		out := s.Out
+		if out == nil {
+			out = os.Stdout
+		}
+
+		_, err = fmt.Fprintf(out, "%s\r\n", body)
+		return err
+	}
+
+	if err = os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+
+	return os.WriteFile(filepath.Join(s.Dir, name), body, 0o644)
+}
@@ -0,0 +1,130 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	ht "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	tt "text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Message is a rendered email ready to be handed to a Sender
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Sender delivers a rendered Message through some transport
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// Mailer renders the embedded templates and hands the result to its Sender
+type Mailer struct {
+	sender Sender
+	from   string
+}
+
+// New returns a Mailer sending messages from the given address
+func New(sender Sender, from string) *Mailer {
+	return &Mailer{
+		sender: sender,
+		from:   from,
+	}
+}
+
+// Send renders templateFile with data and sends it to recipient. The template must
+// define the "subject", "plainBody" and "htmlBody" blocks.
+func (m *Mailer) Send(recipient, templateFile string, data any) error {
+	textTmpl, err := tt.New("").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	subject := new(bytes.Buffer)
+	if err = textTmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return err
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return err
+	}
+
+	htmlTmpl, err := ht.New("").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return err
+	}
+
+	return m.sender.Send(&Message{
+		From:      m.from,
+		To:        recipient,
+		Subject:   strings.TrimSpace(subject.String()),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	})
+}
+
+// Bytes encodes the message as a multipart/alternative MIME document
+func (msg *Message) Bytes() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	fmt.Fprintf(buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", msg.PlainBody},
+		{"text/html; charset=UTF-8", msg.HTMLBody},
+	}
+
+	for _, p := range parts {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", p.contentType)
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+
+		if err = qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPSender delivers messages through an SMTP server
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+func (s *SMTPSender) Send(msg *Message) error {
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+
+	conn, err := net.DialTimeout("tcp", addr, s.Timeout)
+	if err != nil {
+		return err
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(s.Timeout)); err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	defer func(client *smtp.Client) {
+		_ = client.Close()
+	}(client)
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(msg.From); err != nil {
+		return err
+	}
+
+	if err = client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
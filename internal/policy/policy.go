@@ -0,0 +1,36 @@
+package policy
+
+import (
+	"github.com/hvpaiva/greenlight/internal/data"
+)
+
+// Owned is a record that belongs to the user who created it
+type Owned interface {
+	OwnerID() *int64
+}
+
+// Rule authorizes an action on a record once it is loaded. Holders of Any may act on every
+// record, while holders of Own may only act on the records they own.
+type Rule struct {
+	Any string
+	Own string
+}
+
+var MovieWrite = Rule{Any: data.PermissionMovieWriteAny, Own: data.PermissionMovieWriteOwn}
+
+// Allows reports whether the user, holding the given permissions, may act on the record.
+func (r Rule) Allows(userID int64, permissions data.Permissions, record Owned) bool {
+	if permissions.Contains(r.Any) {
+		return true
+	}
+
+	owner := record.OwnerID()
+
+	return permissions.Contains(r.Own) && owner != nil && *owner == userID
+}
+
+// Permissions returns the permissions that may allow the action on some record, for the
+// coarse check done before the record is loaded.
+func (r Rule) Permissions() []string {
+	return []string{r.Any, r.Own}
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key text NOT NULL,
+    user_id bigint NOT NULL,
+    method text NOT NULL,
+    path text NOT NULL,
+    fingerprint bytea NOT NULL,
+    status_code integer,
+    headers jsonb,
+    body bytea,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp(0) with time zone NOT NULL,
+    PRIMARY KEY (key, user_id, method, path)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expiry_idx ON idempotency_keys (expiry);
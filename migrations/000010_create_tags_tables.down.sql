@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'tags:moderate';
+DROP TABLE IF EXISTS movies_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text UNIQUE NOT NULL,
+    banned bool NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS tags_name_prefix_idx ON tags (name text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS movies_tags (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    vote smallint NOT NULL CHECK (vote IN (-1, 1)),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (movie_id, tag_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS movies_tags_tag_id_idx ON movies_tags (tag_id);
+
+INSERT INTO permissions (code)
+VALUES ('tags:moderate');
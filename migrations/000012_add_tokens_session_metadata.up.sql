@@ -0,0 +1,8 @@
+ALTER TABLE tokens
+    ADD COLUMN id bigserial UNIQUE,
+    ADD COLUMN created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ADD COLUMN last_used_at timestamp(0) with time zone,
+    ADD COLUMN ip text NOT NULL DEFAULT '',
+    ADD COLUMN user_agent text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_scope_idx ON tokens (user_id, scope);
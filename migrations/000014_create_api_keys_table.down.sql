@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS api_keys;
+
+DELETE FROM users WHERE service_account;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_password_hash_check;
+
+ALTER TABLE users ALTER COLUMN password_hash SET NOT NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS service_account;
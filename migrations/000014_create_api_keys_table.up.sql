@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN service_account bool NOT NULL DEFAULT false;
+
+ALTER TABLE users ALTER COLUMN password_hash DROP NOT NULL;
+
+ALTER TABLE users ADD CONSTRAINT users_password_hash_check CHECK (service_account OR password_hash IS NOT NULL);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    hash bytea UNIQUE NOT NULL,
+    prefix text NOT NULL,
+    expiry timestamp(0) with time zone,
+    permissions text[] NOT NULL DEFAULT '{}',
+    last_used_at timestamp(0) with time zone,
+    UNIQUE (user_id, name)
+);
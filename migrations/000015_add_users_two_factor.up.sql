@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN totp_secret text;
+ALTER TABLE users ADD COLUMN totp_enabled bool NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN totp_required bool NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    hash bytea NOT NULL,
+    used_at timestamp(0) with time zone,
+    UNIQUE (user_id, hash)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+    kind text NOT NULL,
+    subject text NOT NULL,
+    failures integer NOT NULL DEFAULT 0,
+    last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    blocked_until timestamp(0) with time zone,
+    PRIMARY KEY (kind, subject)
+);
+
+CREATE INDEX IF NOT EXISTS login_throttles_blocked_until_idx ON login_throttles (blocked_until);
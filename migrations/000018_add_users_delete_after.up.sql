@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN delete_after timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS users_delete_after_idx ON users (delete_after) WHERE delete_after IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN suspended bool NOT NULL DEFAULT false;
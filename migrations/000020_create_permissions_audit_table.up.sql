@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS permissions_audit (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    actor_id bigint REFERENCES users ON DELETE SET NULL,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    action text NOT NULL CHECK (action IN ('grant', 'revoke')),
+    permission text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS permissions_audit_user_id_idx ON permissions_audit (user_id, created_at);
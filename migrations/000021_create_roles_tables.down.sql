@@ -0,0 +1,10 @@
+DELETE FROM permissions_audit WHERE action IN ('assign', 'unassign');
+ALTER TABLE permissions_audit DROP CONSTRAINT IF EXISTS permissions_audit_action_check;
+ALTER TABLE permissions_audit ADD CONSTRAINT permissions_audit_action_check
+    CHECK (action IN ('grant', 'revoke'));
+ALTER TABLE permissions_audit DROP COLUMN IF EXISTS role;
+ALTER TABLE permissions_audit ALTER COLUMN permission SET NOT NULL;
+
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles_permissions;
+DROP TABLE IF EXISTS roles;
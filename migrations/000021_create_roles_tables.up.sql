@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text UNIQUE NOT NULL,
+    description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS users_roles_role_id_idx ON users_roles (role_id);
+
+INSERT INTO roles (name, description)
+VALUES
+    ('viewer', 'Browse the catalogue'),
+    ('editor', 'Maintain the catalogue and moderate tags'),
+    ('admin', 'Full access, including user management');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT r.id, p.id
+FROM roles r
+INNER JOIN permissions p ON
+    (r.name = 'viewer' AND p.code = 'movies:read') OR
+    (r.name = 'editor' AND p.code IN ('movies:read', 'movies:write', 'tags:moderate')) OR
+    (r.name = 'admin');
+
+ALTER TABLE permissions_audit ALTER COLUMN permission DROP NOT NULL;
+ALTER TABLE permissions_audit ADD COLUMN role text;
+ALTER TABLE permissions_audit DROP CONSTRAINT IF EXISTS permissions_audit_action_check;
+ALTER TABLE permissions_audit ADD CONSTRAINT permissions_audit_action_check
+    CHECK (action IN ('grant', 'revoke', 'assign', 'unassign'));
@@ -0,0 +1,27 @@
+INSERT INTO permissions (code)
+VALUES ('movies:write');
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT DISTINCT up.user_id, (SELECT id FROM permissions WHERE code = 'movies:write')
+FROM users_permissions up
+INNER JOIN permissions p ON p.id = up.permission_id
+WHERE p.code IN ('movies:write:own', 'movies:write:any');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT DISTINCT rp.role_id, (SELECT id FROM permissions WHERE code = 'movies:write')
+FROM roles_permissions rp
+INNER JOIN permissions p ON p.id = rp.permission_id
+WHERE p.code IN ('movies:write:own', 'movies:write:any');
+
+UPDATE api_keys
+SET permissions = ARRAY(
+    SELECT DISTINCT unnest(array_replace(array_replace(permissions, 'movies:write:own', 'movies:write'), 'movies:write:any', 'movies:write'))
+)
+WHERE permissions && ARRAY['movies:write:own', 'movies:write:any'];
+
+DELETE FROM permissions WHERE code IN ('movies:write:own', 'movies:write:any');
+
+DROP INDEX IF EXISTS movies_created_by_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE movies DROP COLUMN IF EXISTS created_by;
@@ -0,0 +1,28 @@
+ALTER TABLE movies ADD COLUMN created_by bigint REFERENCES users ON DELETE SET NULL;
+ALTER TABLE movies ADD COLUMN updated_by bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS movies_created_by_idx ON movies (created_by);
+
+INSERT INTO permissions (code)
+VALUES
+    ('movies:write:own'),
+    ('movies:write:any');
+
+-- Everyone who could write any movie keeps doing so.
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT up.user_id, (SELECT id FROM permissions WHERE code = 'movies:write:any')
+FROM users_permissions up
+INNER JOIN permissions p ON p.id = up.permission_id
+WHERE p.code = 'movies:write';
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT rp.role_id, (SELECT id FROM permissions WHERE code = 'movies:write:any')
+FROM roles_permissions rp
+INNER JOIN permissions p ON p.id = rp.permission_id
+WHERE p.code = 'movies:write';
+
+UPDATE api_keys
+SET permissions = array_replace(permissions, 'movies:write', 'movies:write:any')
+WHERE 'movies:write' = ANY(permissions);
+
+DELETE FROM permissions WHERE code = 'movies:write';
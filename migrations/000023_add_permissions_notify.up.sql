@@ -0,0 +1,33 @@
+-- Tells the API instances listening on the channel whose permissions changed. An empty
+-- payload means a role changed, which may affect any user.
+CREATE OR REPLACE FUNCTION notify_permissions_changed() RETURNS trigger AS $$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME = 'roles_permissions' THEN
+        PERFORM pg_notify('permissions_changed', '');
+    ELSE
+        PERFORM pg_notify('permissions_changed', changed.user_id::text);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_permissions_notify
+AFTER INSERT OR UPDATE OR DELETE ON users_permissions
+FOR EACH ROW EXECUTE FUNCTION notify_permissions_changed();
+
+CREATE TRIGGER users_roles_notify
+AFTER INSERT OR UPDATE OR DELETE ON users_roles
+FOR EACH ROW EXECUTE FUNCTION notify_permissions_changed();
+
+CREATE TRIGGER roles_permissions_notify
+AFTER INSERT OR UPDATE OR DELETE ON roles_permissions
+FOR EACH ROW EXECUTE FUNCTION notify_permissions_changed();
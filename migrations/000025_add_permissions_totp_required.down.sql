@@ -0,0 +1,24 @@
+DROP TRIGGER IF EXISTS permissions_notify ON permissions;
+
+CREATE OR REPLACE FUNCTION notify_permissions_changed() RETURNS trigger AS $$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME = 'roles_permissions' THEN
+        PERFORM pg_notify('permissions_changed', '');
+    ELSE
+        PERFORM pg_notify('permissions_changed', changed.user_id::text);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE users ADD COLUMN totp_required bool NOT NULL DEFAULT false;
+ALTER TABLE permissions DROP COLUMN IF EXISTS totp_required;
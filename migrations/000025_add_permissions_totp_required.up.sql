@@ -0,0 +1,29 @@
+ALTER TABLE permissions ADD COLUMN totp_required bool NOT NULL DEFAULT false;
+ALTER TABLE users DROP COLUMN IF EXISTS totp_required;
+
+-- Requiring two-factor authentication for a permission may affect any user, so it is
+-- notified with an empty payload like a role change.
+CREATE OR REPLACE FUNCTION notify_permissions_changed() RETURNS trigger AS $$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME IN ('roles_permissions', 'permissions') THEN
+        PERFORM pg_notify('permissions_changed', '');
+    ELSE
+        PERFORM pg_notify('permissions_changed', changed.user_id::text);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER permissions_notify
+AFTER UPDATE OF totp_required ON permissions
+FOR EACH ROW WHEN (OLD.totp_required IS DISTINCT FROM NEW.totp_required)
+EXECUTE FUNCTION notify_permissions_changed();
@@ -0,0 +1,22 @@
+DROP TRIGGER IF EXISTS permissions_delete_notify ON permissions;
+DROP TRIGGER IF EXISTS users_suspended_notify ON users;
+
+CREATE OR REPLACE FUNCTION notify_permissions_changed() RETURNS trigger AS $$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME IN ('roles_permissions', 'permissions') THEN
+        PERFORM pg_notify('permissions_changed', '');
+    ELSE
+        PERFORM pg_notify('permissions_changed', changed.user_id::text);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,34 @@
+-- The API instances also cache whether users are suspended, so suspending a user is
+-- notified on the same channel as a change of its permissions. Rows of permissions are
+-- notified by permissions_notify (000025) when their totp_required changes and by
+-- permissions_delete_notify below when a permission requiring two-factor is deleted.
+CREATE OR REPLACE FUNCTION notify_permissions_changed() RETURNS trigger AS $$
+DECLARE
+    changed record;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    IF TG_TABLE_NAME IN ('roles_permissions', 'permissions') THEN
+        PERFORM pg_notify('permissions_changed', '');
+    ELSIF TG_TABLE_NAME = 'users' THEN
+        PERFORM pg_notify('permissions_changed', changed.id::text);
+    ELSE
+        PERFORM pg_notify('permissions_changed', changed.user_id::text);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_suspended_notify
+AFTER UPDATE OF suspended OR DELETE ON users
+FOR EACH ROW EXECUTE FUNCTION notify_permissions_changed();
+
+CREATE TRIGGER permissions_delete_notify
+AFTER DELETE ON permissions
+FOR EACH ROW WHEN (OLD.totp_required)
+EXECUTE FUNCTION notify_permissions_changed();
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS permissions_audit_role_idx;
+
+DELETE FROM permissions_audit WHERE user_id IS NULL;
+ALTER TABLE permissions_audit DROP CONSTRAINT IF EXISTS permissions_audit_action_check;
+ALTER TABLE permissions_audit ADD CONSTRAINT permissions_audit_action_check
+    CHECK (action IN ('grant', 'revoke', 'assign', 'unassign'));
+ALTER TABLE permissions_audit ALTER COLUMN user_id SET NOT NULL;
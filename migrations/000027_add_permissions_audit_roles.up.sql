@@ -0,0 +1,8 @@
+-- Changes to a role itself are recorded without a user: grant and revoke rows then name
+-- the permissions added to or removed from the role, and a delete row its deletion.
+ALTER TABLE permissions_audit ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE permissions_audit DROP CONSTRAINT IF EXISTS permissions_audit_action_check;
+ALTER TABLE permissions_audit ADD CONSTRAINT permissions_audit_action_check
+    CHECK (action IN ('grant', 'revoke', 'assign', 'unassign', 'delete'));
+
+CREATE INDEX IF NOT EXISTS permissions_audit_role_idx ON permissions_audit (role, created_at) WHERE user_id IS NULL;
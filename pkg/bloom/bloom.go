@@ -0,0 +1,80 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+// Filter is a compact set of strings which may report a string it does not hold as
+// present, at the false positive rate it was sized for, but never misses one it holds.
+type Filter struct {
+	bits   []uint64
+	m      uint64
+	k      uint64
+	length int
+}
+
+// New returns an empty Filter sized to hold n strings at the false positive rate p
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// Add inserts s into the filter
+func (f *Filter) Add(s string) {
+	h1, h2 := hash(s)
+
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+
+	f.length++
+}
+
+// Contains reports whether s may have been added to the filter
+func (f *Filter) Contains(s string) bool {
+	h1, h2 := hash(s)
+
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Len returns how many strings were added to the filter
+func (f *Filter) Len() int {
+	return f.length
+}
+
+// hash returns the two halves of the 128-bit FNV-1a hash of s, combined by the filter to
+// derive its k bit positions.
+func hash(s string) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(s))
+	sum := h.Sum(nil)
+
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:]) | 1
+}
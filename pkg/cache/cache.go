@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache is a concurrency safe in-memory store whose entries expire after a fixed TTL
+type Cache[K comparable, V any] struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[K]entry[V]
+
+	// generation counts the invalidations. The generation at which each key was last
+	// deleted, and at which the whole cache was last cleared, tell SetIfCurrent whether a
+	// value was loaded before an invalidation it must not undo.
+	generation  uint64
+	cleared     uint64
+	invalidated map[K]invalidation
+}
+
+type invalidation struct {
+	generation uint64
+	at         time.Time
+}
+
+type entry[V any] struct {
+	value  V
+	expiry time.Time
+}
+
+// New returns a new Cache whose entries live for the given TTL
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		ttl:         ttl,
+		entries:     make(map[K]entry[V]),
+		invalidated: make(map[K]invalidation),
+	}
+}
+
+// Get returns the value stored for key, if present and not expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expiry) {
+		var zero V
+		return zero, false
+	}
+
+	return e.value, true
+}
+
+// Set stores value for key
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(key, value)
+}
+
+func (c *Cache[K, V]) set(key K, value V) {
+	c.entries[key] = entry[V]{value: value, expiry: time.Now().Add(c.ttl)}
+}
+
+// Generation returns the current generation of the cache, to be taken before loading a
+// value that is then stored with SetIfCurrent.
+func (c *Cache[K, V]) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.generation
+}
+
+// SetIfCurrent stores value for key unless key was deleted, or the cache cleared, since
+// the generation was taken. It reports whether the value was stored. Deletions are only
+// remembered for a TTL, which loads are expected to take much less than.
+func (c *Cache[K, V]) SetIfCurrent(key K, value V, generation uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cleared > generation || c.invalidated[key].generation > generation {
+		return false
+	}
+
+	c.set(key, value)
+
+	return true
+}
+
+// Delete removes the value stored for key
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.invalidated[key] = invalidation{generation: c.generation, at: time.Now()}
+
+	delete(c.entries, key)
+}
+
+// Clear removes every value from the cache
+func (c *Cache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.cleared = c.generation
+
+	clear(c.entries)
+	clear(c.invalidated)
+}
+
+// DeleteExpired evicts the expired entries, along with the deletions old enough to be
+// forgotten. Expired entries are never returned, but stay in memory until then, so it
+// should be called periodically.
+func (c *Cache[K, V]) DeleteExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	for k, e := range c.entries {
+		if now.After(e.expiry) {
+			delete(c.entries, k)
+		}
+	}
+
+	for k, i := range c.invalidated {
+		if now.Sub(i.at) > c.ttl {
+			delete(c.invalidated, k)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+// Key is a single signing or verification key identified by its kid
+type Key struct {
+	ID        string
+	Algorithm string
+
+	secret     []byte
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+	rsaKey     *rsa.PublicKey
+}
+
+// CanSign reports whether the key holds the material needed to sign tokens
+func (k *Key) CanSign() bool {
+	switch k.Algorithm {
+	case AlgHS256:
+		return len(k.secret) > 0
+	case AlgEdDSA:
+		return k.privateKey != nil
+	default:
+		return false
+	}
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	K   string `json:"k"`
+	X   string `json:"x"`
+	D   string `json:"d"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Use string `json:"use"`
+}
+
+// KeySet is a set of keys loaded from a local JWKS file, which can be reloaded to
+// rotate keys without restarting the application
+type KeySet struct {
+	mu      sync.RWMutex
+	path    string
+	modTime time.Time
+	keys    map[string]*Key
+}
+
+// LoadKeySet reads the JWKS file at path
+func LoadKeySet(path string) (*KeySet, error) {
+	ks := &KeySet{path: path}
+
+	if _, err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// ParseKeySet reads a JWKS document published by a third party, such as an identity
+// provider. Only asymmetric keys are accepted, since a public document must never supply
+// a shared secret. Keys the package cannot verify with, or that are not meant for
+// signatures, are skipped rather than rejected, since providers publish keys for other
+// uses too. RSA keys are only supported here, for verification.
+func ParseKeySet(raw []byte) (*KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := make(map[string]*Key, len(set.Keys))
+
+	for _, k := range set.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		var (
+			key *Key
+			err error
+		)
+
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k)
+		case "OKP":
+			key, err = parseKey(k)
+		default:
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("invalid jwks: no supported signing keys")
+	}
+
+	return &KeySet{keys: keys}, nil
+}
+
+// Key returns the key with the given kid
+func (ks *KeySet) Key(kid string) (*Key, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Reload reads the JWKS file again if it changed since the last load, reporting whether
+// the keys were replaced
+func (ks *KeySet) Reload() (bool, error) {
+	info, err := os.Stat(ks.path)
+	if err != nil {
+		return false, err
+	}
+
+	ks.mu.RLock()
+	unchanged := info.ModTime().Equal(ks.modTime)
+	ks.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	raw, err := os.ReadFile(ks.path)
+	if err != nil {
+		return false, err
+	}
+
+	keys, err := parseKeys(raw)
+	if err != nil {
+		return false, err
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.modTime = info.ModTime()
+	ks.mu.Unlock()
+
+	return true, nil
+}
+
+func parseKeys(raw []byte) (map[string]*Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, errors.New("invalid jwks: no keys")
+	}
+
+	keys := make(map[string]*Key, len(set.Keys))
+
+	for _, k := range set.Keys {
+		if k.Kid == "" {
+			return nil, errors.New("invalid jwks: every key must have a kid")
+		}
+
+		if _, dup := keys[k.Kid]; dup {
+			return nil, fmt.Errorf("invalid jwks: duplicate kid %q", k.Kid)
+		}
+
+		key, err := parseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwks key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func parseKey(k jwk) (*Key, error) {
+	key := &Key{ID: k.Kid}
+
+	switch {
+	case k.Kty == "oct" && (k.Alg == "" || k.Alg == AlgHS256):
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes long")
+		}
+
+		key.Algorithm = AlgHS256
+		key.secret = secret
+	case k.Kty == "OKP" && k.Crv == "Ed25519" && (k.Alg == "" || k.Alg == AlgEdDSA):
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key size")
+		}
+
+		key.Algorithm = AlgEdDSA
+		key.publicKey = x
+
+		if k.D != "" {
+			d, err := base64.RawURLEncoding.DecodeString(k.D)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(d) != ed25519.SeedSize {
+				return nil, errors.New("invalid Ed25519 private key size")
+			}
+
+			key.privateKey = ed25519.NewKeyFromSeed(d)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+
+	return key, nil
+}
+
+func parseRSAKey(k jwk) (*Key, error) {
+	if k.Alg != "" && k.Alg != AlgRS256 {
+		return nil, fmt.Errorf("unsupported RSA algorithm %q", k.Alg)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid RSA public exponent")
+	}
+
+	publicKey := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+
+	if publicKey.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must be at least 2048 bits long")
+	}
+
+	return &Key{ID: k.Kid, Algorithm: AlgRS256, rsaKey: publicKey}, nil
+}
@@ -0,0 +1,211 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token expired")
+	ErrNotYetValid      = errors.New("token not yet valid")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+)
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Audience is the aud claim, which may be encoded either as a string or an array
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+
+	*a = many
+
+	return nil
+}
+
+// RegisteredClaims holds the claims defined by RFC 7519. Applications embed it in their
+// own claims struct.
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+func (c *RegisteredClaims) Registered() *RegisteredClaims {
+	return c
+}
+
+// Claims is implemented by any struct embedding RegisteredClaims
+type Claims interface {
+	Registered() *RegisteredClaims
+}
+
+// Expectations are the registered claim values a token must satisfy to be accepted
+type Expectations struct {
+	Issuer   string
+	Audience string
+	Leeway   time.Duration
+}
+
+// Sign encodes claims as a compact JWS signed with key
+func Sign(claims Claims, key *Key) (string, error) {
+	if !key.CanSign() {
+		return "", ErrUnknownKey
+	}
+
+	h, err := json.Marshal(header{Alg: key.Algorithm, Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encode(h) + "." + encode(payload)
+
+	var signature []byte
+
+	switch key.Algorithm {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case AlgEdDSA:
+		signature = ed25519.Sign(key.privateKey, []byte(signingInput))
+	}
+
+	return signingInput + "." + encode(signature), nil
+}
+
+// Parse verifies the token signature against the key set, decodes it into claims and
+// validates the registered claims against expect
+func Parse(token string, keys *KeySet, claims Claims, expect Expectations) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return ErrMalformed
+	}
+
+	key, ok := keys.Key(h.Kid)
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	if h.Alg != key.Algorithm {
+		return ErrInvalidSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if !verify(key, parts[0]+"."+parts[1], signature) {
+		return ErrInvalidSignature
+	}
+
+	if err = decodeJSON(parts[1], claims); err != nil {
+		return ErrMalformed
+	}
+
+	return validate(claims.Registered(), expect, time.Now())
+}
+
+// IsJWT reports whether token looks like a compact JWS rather than an opaque token
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func verify(key *Key, signingInput string, signature []byte) bool {
+	switch key.Algorithm {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write([]byte(signingInput))
+		return hmac.Equal(signature, mac.Sum(nil))
+	case AlgEdDSA:
+		return ed25519.Verify(key.publicKey, []byte(signingInput), signature)
+	case AlgRS256:
+		digest := sha256.Sum256([]byte(signingInput))
+		return rsa.VerifyPKCS1v15(key.rsaKey, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
+
+func validate(c *RegisteredClaims, expect Expectations, now time.Time) error {
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(expect.Leeway)) {
+		return ErrExpired
+	}
+
+	if c.NotBefore != 0 && now.Add(expect.Leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrNotYetValid
+	}
+
+	if expect.Issuer != "" && c.Issuer != expect.Issuer {
+		return ErrInvalidIssuer
+	}
+
+	if expect.Audience != "" && !slices.Contains(c.Audience, expect.Audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(segment string, dst any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, dst)
+}
@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hvpaiva/greenlight/pkg/validator"
 )
@@ -43,3 +44,19 @@ func ReadInt(qs url.Values, key string, defaultValue int, v *validator.Validator
 
 	return i
 }
+
+func ReadDate(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		v.AddError(key, "must be a date in the YYYY-MM-DD format")
+		return defaultValue
+	}
+
+	return t
+}
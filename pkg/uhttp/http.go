@@ -1,6 +1,9 @@
 package uhttp
 
-import "net/http"
+import (
+	"bytes"
+	"net/http"
+)
 
 type MetricsResponseWriter struct {
 	http.ResponseWriter
@@ -32,3 +35,36 @@ func (mw *MetricsResponseWriter) Write(b []byte) (int, error) {
 func (mw *MetricsResponseWriter) Unwrap() http.ResponseWriter {
 	return mw.ResponseWriter
 }
+
+type RecordingResponseWriter struct {
+	http.ResponseWriter
+	StatusCode    int
+	Body          bytes.Buffer
+	HeaderWritten bool
+}
+
+func NewRecordingResponseWriter(w http.ResponseWriter) *RecordingResponseWriter {
+	return &RecordingResponseWriter{
+		ResponseWriter: w,
+		StatusCode:     http.StatusOK,
+	}
+}
+
+func (rw *RecordingResponseWriter) WriteHeader(statusCode int) {
+	rw.ResponseWriter.WriteHeader(statusCode)
+
+	if !rw.HeaderWritten {
+		rw.StatusCode = statusCode
+		rw.HeaderWritten = true
+	}
+}
+
+func (rw *RecordingResponseWriter) Write(b []byte) (int, error) {
+	rw.HeaderWritten = true
+	rw.Body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *RecordingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}